@@ -0,0 +1,212 @@
+// Package fake provides fake adapter implementations for unit-testing code using gue without a database.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+// Call is a single query executed on Tx
+type Call struct {
+	SQL  string
+	Args []interface{}
+}
+
+type fakeExecResult struct {
+	sqlPart      string
+	rowsAffected int64
+	err          error
+}
+
+type fakeRowResult struct {
+	sqlPart string
+	values  []interface{}
+	err     error
+}
+
+// Tx implements adapter.Tx that records all the executed queries and returns scripted results,
+// so that code using transaction can be unit-tested without a database.
+//
+// Results are matched by the SQL substring in the order they were scripted and every scripted
+// result is returned once, so script the result several times to return it for several calls,
+// or script different results for successive calls with the same SQL. Exec without matching
+// result affects no rows, QueryRow without matching result returns adapter.ErrNoRows.
+type Tx struct {
+	mu         sync.Mutex
+	calls      []Call
+	execs      []fakeExecResult
+	rows       []fakeRowResult
+	committed  bool
+	rolledBack bool
+}
+
+// NewTx instantiates new Tx
+func NewTx() *Tx {
+	return &Tx{}
+}
+
+// OnExec scripts the result of a single Exec call with the SQL containing sqlPart
+func (tx *Tx) OnExec(sqlPart string, rowsAffected int64, err error) *Tx {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.execs = append(tx.execs, fakeExecResult{sqlPart: sqlPart, rowsAffected: rowsAffected, err: err})
+	return tx
+}
+
+// OnQueryRow scripts the result of a single QueryRow call with the SQL containing sqlPart.
+// Row values are assigned to the Scan destinations positionally.
+func (tx *Tx) OnQueryRow(sqlPart string, values []interface{}, err error) *Tx {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.rows = append(tx.rows, fakeRowResult{sqlPart: sqlPart, values: values, err: err})
+	return tx
+}
+
+// Exec implements adapter.Tx.Exec() recording the call
+func (tx *Tx) Exec(ctx context.Context, sql string, arguments ...interface{}) (adapter.CommandTag, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if err := tx.record(sql, arguments); err != nil {
+		return fakeCommandTag(0), err
+	}
+
+	for i, r := range tx.execs {
+		if strings.Contains(sql, r.sqlPart) {
+			tx.execs = append(tx.execs[:i], tx.execs[i+1:]...)
+			return fakeCommandTag(r.rowsAffected), r.err
+		}
+	}
+
+	return fakeCommandTag(0), nil
+}
+
+// QueryRow implements adapter.Tx.QueryRow() recording the call
+func (tx *Tx) QueryRow(ctx context.Context, sql string, args ...interface{}) adapter.Row {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if err := tx.record(sql, args); err != nil {
+		return &fakeRow{err: err}
+	}
+
+	for i, r := range tx.rows {
+		if strings.Contains(sql, r.sqlPart) {
+			tx.rows = append(tx.rows[:i], tx.rows[i+1:]...)
+			return &fakeRow{values: r.values, err: r.err}
+		}
+	}
+
+	return &fakeRow{err: adapter.ErrNoRows}
+}
+
+// Rollback implements adapter.Tx.Rollback()
+func (tx *Tx) Rollback(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.committed || tx.rolledBack {
+		return adapter.ErrTxClosed
+	}
+
+	tx.rolledBack = true
+	return nil
+}
+
+// Commit implements adapter.Tx.Commit()
+func (tx *Tx) Commit(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.committed || tx.rolledBack {
+		return adapter.ErrTxClosed
+	}
+
+	tx.committed = true
+	return nil
+}
+
+// Calls returns all the queries executed on the transaction
+func (tx *Tx) Calls() []Call {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return append([]Call(nil), tx.calls...)
+}
+
+// Committed returns true if the transaction was committed
+func (tx *Tx) Committed() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.committed
+}
+
+// RolledBack returns true if the transaction was rolled back
+func (tx *Tx) RolledBack() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.rolledBack
+}
+
+func (tx *Tx) record(sql string, args []interface{}) error {
+	if tx.committed || tx.rolledBack {
+		return adapter.ErrTxClosed
+	}
+
+	tx.calls = append(tx.calls, Call{SQL: sql, Args: args})
+	return nil
+}
+
+// fakeCommandTag implements adapter.CommandTag for Tx
+type fakeCommandTag int64
+
+// RowsAffected implements adapter.CommandTag.RowsAffected() for Tx
+func (ct fakeCommandTag) RowsAffected() int64 {
+	return int64(ct)
+}
+
+// fakeRow implements adapter.Row for Tx
+type fakeRow struct {
+	values []interface{}
+	err    error
+}
+
+// Scan implements adapter.Row.Scan() for Tx
+func (r *fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if len(dest) != len(r.values) {
+		return fmt.Errorf("scan expects %d destinations, got %d", len(r.values), len(dest))
+	}
+
+	for i, v := range r.values {
+		dst := reflect.ValueOf(dest[i])
+		if dst.Kind() != reflect.Ptr || dst.IsNil() {
+			return fmt.Errorf("scan destination %d is not a pointer", i)
+		}
+
+		if v == nil {
+			dst.Elem().Set(reflect.Zero(dst.Elem().Type()))
+			continue
+		}
+
+		src := reflect.ValueOf(v)
+		if !src.Type().ConvertibleTo(dst.Elem().Type()) {
+			return fmt.Errorf("can not scan value %d of type %T into %s", i, v, dst.Elem().Type())
+		}
+		dst.Elem().Set(src.Convert(dst.Elem().Type()))
+	}
+
+	return nil
+}
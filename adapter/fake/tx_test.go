@@ -0,0 +1,45 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+func TestTxScriptedResults(t *testing.T) {
+	ctx := context.Background()
+	errLocked := errors.New("row is locked")
+	tx := NewTx().
+		OnQueryRow("SELECT balance", []interface{}{int64(42)}, nil).
+		OnQueryRow("SELECT balance", []interface{}{int64(43)}, nil).
+		OnExec("UPDATE accounts", 0, errLocked).
+		OnExec("UPDATE accounts", 1, nil)
+
+	var balance int64
+	require.NoError(t, tx.QueryRow(ctx, `SELECT balance FROM accounts`).Scan(&balance))
+	assert.Equal(t, int64(42), balance)
+	require.NoError(t, tx.QueryRow(ctx, `SELECT balance FROM accounts`).Scan(&balance))
+	assert.Equal(t, int64(43), balance)
+	assert.Equal(t, adapter.ErrNoRows, tx.QueryRow(ctx, `SELECT balance FROM accounts`).Scan(&balance))
+
+	_, err := tx.Exec(ctx, `UPDATE accounts SET balance = 0`)
+	assert.Equal(t, errLocked, err)
+	ct, err := tx.Exec(ctx, `UPDATE accounts SET balance = 0`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), ct.RowsAffected())
+	ct, err = tx.Exec(ctx, `UPDATE accounts SET balance = 0`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), ct.RowsAffected())
+
+	require.NoError(t, tx.Commit(ctx))
+	assert.True(t, tx.Committed())
+	assert.Equal(t, adapter.ErrTxClosed, tx.Rollback(ctx))
+	_, err = tx.Exec(ctx, `UPDATE accounts SET balance = 0`)
+	assert.Equal(t, adapter.ErrTxClosed, err)
+	assert.Len(t, tx.Calls(), 6)
+}
@@ -77,7 +77,7 @@ func testConnPGXv3Config(t testing.TB) pgx.ConnConfig {
 func truncateAndClose(t testing.TB, pool adapter.ConnPool) {
 	t.Helper()
 
-	_, err := pool.Exec(context.Background(), "TRUNCATE TABLE gue_jobs")
+	_, err := pool.Exec(context.Background(), "TRUNCATE TABLE gue_jobs, gue_memoized_results, gue_child_outcomes, gue_quota_counts, gue_spool_keys, gue_shed_stats, gue_skipped_jobs")
 	assert.NoError(t, err)
 
 	err = pool.Close()
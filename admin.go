@@ -0,0 +1,264 @@
+package gue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+const exportBatchSize = 1000
+
+// jobRow is the JSON representation of gue_jobs row used by administrative operations.
+type jobRow struct {
+	ID               int64           `json:"job_id"`
+	Queue            string          `json:"queue"`
+	Priority         int16           `json:"priority"`
+	RunAt            time.Time       `json:"run_at"`
+	Type             string          `json:"job_type"`
+	Args             json.RawMessage `json:"args"`
+	ErrorCount       int32           `json:"error_count"`
+	LastError        *string         `json:"last_error"`
+	RetrySchedule    *RetrySchedule  `json:"retry_schedule"`
+	LastFailedHost   *string         `json:"last_failed_host"`
+	LastFailedWorker *string         `json:"last_failed_worker"`
+	ParentID         *int64          `json:"parent_id"`
+	QuotaKey         *string         `json:"quota_key"`
+	Guard            *Guard          `json:"guard"`
+	Failures         []JobFailure    `json:"failures"`
+}
+
+func (r jobRow) job() *Job {
+	j := &Job{
+		ID:            r.ID,
+		Queue:         r.Queue,
+		Priority:      r.Priority,
+		RunAt:         r.RunAt,
+		Type:          r.Type,
+		Args:          []byte(r.Args),
+		ErrorCount:    r.ErrorCount,
+		RetrySchedule: r.RetrySchedule,
+		Guard:         r.Guard,
+		Failures:      r.Failures,
+	}
+	j.LastError = nullableText(r.LastError)
+	j.LastFailedHost = nullableText(r.LastFailedHost)
+	j.LastFailedWorker = nullableText(r.LastFailedWorker)
+	if r.ParentID != nil {
+		j.ParentID = *r.ParentID
+	}
+	if r.QuotaKey != nil {
+		j.QuotaKey = *r.QuotaKey
+	}
+
+	return j
+}
+
+func nullableText(s *string) pgtype.Text {
+	if s == nil {
+		return pgtype.Text{Status: pgtype.Null}
+	}
+	return pgtype.Text{String: *s, Status: pgtype.Present}
+}
+
+// fetchJobRows returns JSON rows of jobs matching the filter with ID greater than afterID
+// ordered by ID.
+func (c *Client) fetchJobRows(ctx context.Context, f *Filter, afterID int64, limit int) ([]json.RawMessage, error) {
+	where, args := f.where(0)
+	args = append(args, afterID, limit)
+
+	var data []byte
+	err := c.pool.QueryRow(ctx, fmt.Sprintf(`SELECT coalesce(json_agg(t ORDER BY t.job_id), '[]')::text
+FROM (
+  SELECT job_id, queue, priority, run_at, job_type, args, error_count, last_error, retry_schedule,
+         last_failed_host, last_failed_worker, parent_id, quota_key, guard, failures, created_at, updated_at
+  FROM gue_jobs
+  WHERE (%s) AND job_id > $%d
+  ORDER BY job_id
+  LIMIT $%d
+) t`, where, len(args)-1, len(args)), args...).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("could not unmarshal jobs: %w", err)
+	}
+
+	return rows, nil
+}
+
+// ListJobs returns up to limit jobs matching the filter ordered by ID.
+// Returned jobs are not locked, so they can not be worked or marked as done.
+func (c *Client) ListJobs(ctx context.Context, f *Filter, limit int) ([]*Job, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := c.fetchJobRows(ctx, f, 0, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(rows))
+	for _, data := range rows {
+		var r jobRow
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("could not unmarshal job: %w", err)
+		}
+		jobs = append(jobs, r.job())
+	}
+
+	return jobs, nil
+}
+
+// CountJobs returns the number of jobs matching the filter.
+func (c *Client) CountJobs(ctx context.Context, f *Filter) (int64, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	where, args := f.where(0)
+
+	var count int64
+	err = c.pool.QueryRow(ctx, `SELECT count(*) FROM gue_jobs WHERE `+where, args...).Scan(&count)
+
+	return count, err
+}
+
+// CancelJobs deletes jobs matching the filter and returns the number of deleted jobs.
+// Jobs that are being worked at the moment are skipped. Cancelled child jobs are
+// finished with an error, so that their parents do not wait for them forever.
+func (c *Client) CancelJobs(ctx context.Context, f *Filter) (int64, error) {
+	if f == nil {
+		return 0, ErrNilFilter
+	}
+
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	where, args := f.where(0)
+	args = append(args, time.Now())
+
+	var cancelled int64
+	err = c.pool.QueryRow(ctx, fmt.Sprintf(`WITH cancelled AS (
+  DELETE FROM gue_jobs
+  WHERE job_id IN (SELECT job_id FROM gue_jobs WHERE %s FOR UPDATE SKIP LOCKED)
+  RETURNING job_id, job_type, parent_id
+), outcomes AS (
+  INSERT INTO gue_child_outcomes (parent_id, child_id, job_type, succeeded, result, error, finished_at)
+  SELECT parent_id, job_id, job_type, false, NULL, 'job was cancelled', $%[2]d
+  FROM cancelled
+  WHERE parent_id IS NOT NULL
+  ON CONFLICT (parent_id, child_id) DO NOTHING
+), parents AS (
+  UPDATE gue_jobs p
+  SET waiting_children = greatest(p.waiting_children - c.children, 0), updated_at = $%[2]d
+  FROM (SELECT parent_id, count(*) AS children FROM cancelled WHERE parent_id IS NOT NULL GROUP BY parent_id) c
+  WHERE p.job_id = c.parent_id
+)
+SELECT count(*) FROM cancelled`, where, len(args)), args...).Scan(&cancelled)
+
+	return cancelled, err
+}
+
+// RetryJobs reschedules jobs matching the filter to be worked right away and returns
+// the number of rescheduled jobs. Jobs that are being worked at the moment are skipped.
+func (c *Client) RetryJobs(ctx context.Context, f *Filter) (int64, error) {
+	if f == nil {
+		return 0, ErrNilFilter
+	}
+
+	where, args := f.where(0)
+	args = append(args, time.Now())
+
+	return c.execAdmin(ctx, fmt.Sprintf(`UPDATE gue_jobs
+SET run_at = $%[1]d, updated_at = $%[1]d
+WHERE job_id IN (SELECT job_id FROM gue_jobs WHERE %[2]s FOR UPDATE SKIP LOCKED)`, len(args), where), args...)
+}
+
+// MoveJobs moves jobs matching the filter to the queue and returns the number of moved jobs.
+// Jobs that are being worked at the moment are skipped.
+func (c *Client) MoveJobs(ctx context.Context, f *Filter, queue string) (int64, error) {
+	if f == nil {
+		return 0, ErrNilFilter
+	}
+
+	where, args := f.where(0)
+	args = append(args, queue, time.Now())
+
+	return c.execAdmin(ctx, fmt.Sprintf(`UPDATE gue_jobs
+SET queue = $%d, updated_at = $%d
+WHERE job_id IN (SELECT job_id FROM gue_jobs WHERE %s FOR UPDATE SKIP LOCKED)`, len(args)-1, len(args), where), args...)
+}
+
+// ExportJobs writes jobs matching the filter to w as JSON objects, one per line, ordered by ID.
+// Returns the number of exported jobs.
+func (c *Client) ExportJobs(ctx context.Context, f *Filter, w io.Writer) (int64, error) {
+	var (
+		exported int64
+		afterID  int64
+	)
+
+	for {
+		rows, err := c.exportBatch(ctx, f, afterID)
+		if err != nil {
+			return exported, err
+		}
+
+		for _, data := range rows {
+			var r struct {
+				ID int64 `json:"job_id"`
+			}
+			if err := json.Unmarshal(data, &r); err != nil {
+				return exported, fmt.Errorf("could not unmarshal job: %w", err)
+			}
+			afterID = r.ID
+
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+
+		if len(rows) < exportBatchSize {
+			return exported, nil
+		}
+	}
+}
+
+func (c *Client) exportBatch(ctx context.Context, f *Filter, afterID int64) ([]json.RawMessage, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return c.fetchJobRows(ctx, f, afterID, exportBatchSize)
+}
+
+func (c *Client) execAdmin(ctx context.Context, sql string, args ...interface{}) (int64, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	ct, err := c.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return ct.RowsAffected(), nil
+}
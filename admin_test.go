@@ -0,0 +1,105 @@
+package gue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
+)
+
+func TestAdminOperations(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testAdminOperations(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testAdminOperations(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testAdminOperations(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testAdminOperations(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool)
+	ctx := context.Background()
+
+	for _, j := range []*Job{
+		{Type: "SendEmail", Args: []byte(`{"customer_id":42}`)},
+		{Type: "SendEmail", Args: []byte(`{"customer_id":43}`)},
+		{Type: "SendEmail", Args: []byte(`{"customer_id":42}`), Queue: "other"},
+		{Type: "Report", Args: []byte(`{"customer_id":42}`)},
+	} {
+		err := c.Enqueue(ctx, j)
+		require.NoError(t, err)
+	}
+
+	f := MustParseFilter(`type = "SendEmail" and args.customer_id = 42 and age < 1h`)
+
+	count, err := c.CountJobs(ctx, f)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = c.CountJobs(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+
+	jobs, err := c.ListJobs(ctx, f, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Less(t, jobs[0].ID, jobs[1].ID)
+	assert.Equal(t, "SendEmail", jobs[0].Type)
+	assert.JSONEq(t, `{"customer_id":42}`, string(jobs[0].Args))
+	assert.Nil(t, jobs[0].Tx())
+
+	buf := new(bytes.Buffer)
+	exported, err := c.ExportJobs(ctx, f, buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), exported)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var row map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+	assert.Equal(t, "SendEmail", row["job_type"])
+
+	moved, err := c.MoveJobs(ctx, MustParseFilter(`queue = "other"`), "moved")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), moved)
+
+	retried, err := c.RetryJobs(ctx, MustParseFilter(`queue = "moved"`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), retried)
+
+	cancelled, err := c.CancelJobs(ctx, f)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cancelled)
+
+	count, err = c.CountJobs(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	cancelled, err = c.CancelJobs(ctx, MatchAllFilter())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cancelled)
+}
+
+func TestAdminOperationsNilFilter(t *testing.T) {
+	c := NewClient(nil)
+	ctx := context.Background()
+
+	_, err := c.CancelJobs(ctx, nil)
+	assert.Equal(t, ErrNilFilter, err)
+
+	_, err = c.RetryJobs(ctx, nil)
+	assert.Equal(t, ErrNilFilter, err)
+
+	_, err = c.MoveJobs(ctx, nil, "other")
+	assert.Equal(t, ErrNilFilter, err)
+}
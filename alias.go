@@ -0,0 +1,50 @@
+package gue
+
+import (
+	"context"
+	"time"
+)
+
+// TypeAliases maps old job type names to the new ones, so that job types can be renamed
+// without downtime: workers dispatch jobs of old types to the handlers of new types,
+// and client can optionally rewrite old types on enqueue.
+type TypeAliases map[string]string
+
+// Resolve returns the final job type name for the given type following the chain
+// of renames, e.g. "a" -> "b" -> "c". Type is returned as is if it has no alias.
+func (a TypeAliases) Resolve(jobType string) string {
+	// every type can be visited at most once, so that cyclic aliases do not loop forever
+	for i := 0; i < len(a); i++ {
+		newType, ok := a[jobType]
+		if !ok || newType == jobType {
+			break
+		}
+		jobType = newType
+	}
+
+	return jobType
+}
+
+// MigrateTypeAliases rewrites types of pending jobs with the old types to the new ones and
+// returns the number of migrated jobs. Call it once no producers enqueue jobs with the old
+// types anymore. Jobs that are being worked at the moment are skipped, so the migration
+// may need to be repeated.
+func (c *Client) MigrateTypeAliases(ctx context.Context) (int64, error) {
+	var migrated int64
+	for oldType := range c.aliases {
+		newType := c.aliases.Resolve(oldType)
+		if newType == oldType {
+			continue
+		}
+
+		n, err := c.execAdmin(ctx, `UPDATE gue_jobs
+SET job_type = $1, updated_at = $2
+WHERE job_id IN (SELECT job_id FROM gue_jobs WHERE job_type = $3 FOR UPDATE SKIP LOCKED)`, newType, time.Now(), oldType)
+		migrated += n
+		if err != nil {
+			return migrated, err
+		}
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,78 @@
+package gue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
+)
+
+func TestTypeAliasesResolve(t *testing.T) {
+	aliases := TypeAliases{"a": "b", "b": "c", "x": "y", "y": "x", "self": "self"}
+
+	assert.Equal(t, "c", aliases.Resolve("a"))
+	assert.Equal(t, "c", aliases.Resolve("b"))
+	assert.Equal(t, "c", aliases.Resolve("c"))
+	assert.Equal(t, "unknown", aliases.Resolve("unknown"))
+	assert.Equal(t, "self", aliases.Resolve("self"))
+	// cyclic aliases do not hang
+	assert.Contains(t, []string{"x", "y"}, aliases.Resolve("x"))
+
+	var nilAliases TypeAliases
+	assert.Equal(t, "a", nilAliases.Resolve("a"))
+}
+
+func TestTypeAliases(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testTypeAliases(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testTypeAliases(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testTypeAliases(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testTypeAliases(t *testing.T, connPool adapter.ConnPool) {
+	aliases := TypeAliases{"OldJob": "NewJob"}
+	c := NewClient(connPool, WithClientTypeAliases(aliases))
+	ctx := context.Background()
+
+	var worked []string
+	wm := WorkMap{
+		"NewJob": func(j *Job) error {
+			worked = append(worked, j.Type)
+			return nil
+		},
+	}
+	w := NewWorker(c, wm)
+
+	err := c.Enqueue(ctx, &Job{Type: "OldJob"})
+	require.NoError(t, err)
+
+	assert.True(t, w.WorkOne(ctx))
+	assert.Equal(t, []string{"OldJob"}, worked)
+	assert.Nil(t, findOneJob(t, connPool))
+
+	err = c.Enqueue(ctx, &Job{Type: "OldJob"})
+	require.NoError(t, err)
+
+	migrated, err := c.MigrateTypeAliases(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), migrated)
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+	assert.Equal(t, "NewJob", j.Type)
+
+	cRewrite := NewClient(connPool, WithClientTypeAliases(aliases), WithClientEnqueueTypeAliases())
+	j = &Job{Type: "OldJob"}
+	err = cRewrite.Enqueue(ctx, j)
+	require.NoError(t, err)
+	assert.Equal(t, "NewJob", j.Type)
+}
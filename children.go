@@ -0,0 +1,171 @@
+package gue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+// defaultChildMaxAttempts is the number of attempts child job without RetrySchedule
+// is worked before it is given up, see WithClientChildMaxAttempts.
+const defaultChildMaxAttempts = 25
+
+// ErrAwaitChildren is returned by WorkFunc to park the job until all the children
+// it spawned with Job.SpawnChild are finished. Parked job does not hold a lock and
+// its error count is not increased. Once all the children are finished, the job is
+// worked again and can get children outcomes with Job.ChildOutcomes. Job that has
+// no pending children is failed with an error instead of being parked.
+var ErrAwaitChildren = errors.New("await children")
+
+// ChildOutcome is the outcome of the finished child job.
+type ChildOutcome struct {
+	// ID is the child job ID.
+	ID int64 `json:"child_id"`
+	// Type is the child job type.
+	Type string `json:"job_type"`
+	// Succeeded is true if the child job was worked successfully or skipped,
+	// false if it was given up.
+	Succeeded bool `json:"succeeded"`
+	// Skipped is true if the child job was not worked because its Guard failed.
+	Skipped bool `json:"skipped"`
+	// Result is the child job Result.
+	Result json.RawMessage `json:"result"`
+	// Error is the last error of the given up child job.
+	Error string `json:"error"`
+	// SkipReason is the reason the child job was skipped with.
+	SkipReason string `json:"skip_reason"`
+}
+
+// childStatus is the status the child job is finished with.
+type childStatus int
+
+const (
+	childSucceeded childStatus = iota
+	childFailed
+	childSkipped
+)
+
+// SpawnChild enqueues child job within the job transaction. Child job is worked once
+// the job transaction is committed. Return ErrAwaitChildren from WorkFunc to wait
+// for the spawned children to finish.
+//
+// Child job is finished when it is worked successfully or given up. Child job without
+// RetrySchedule is given up after the number of attempts set with WithClientChildMaxAttempts.
+func (j *Job) SpawnChild(ctx context.Context, child *Job) error {
+	j.mu.Lock()
+	tx, c := j.tx, j.client
+	j.mu.Unlock()
+
+	if tx == nil {
+		return errors.New("can not spawn child of the job that is already done")
+	}
+	if c == nil {
+		c = NewClient(j.pool)
+	}
+
+	child.ParentID = j.ID
+	return c.execEnqueue(ctx, child, tx)
+}
+
+// ChildOutcomes returns outcomes of the finished children of the job ordered by child ID.
+func (j *Job) ChildOutcomes(ctx context.Context) ([]ChildOutcome, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var data []byte
+	err := j.tx.QueryRow(ctx, `SELECT coalesce(json_agg(o ORDER BY o.child_id), '[]')::text
+FROM (
+  SELECT child_id, job_type, succeeded, skip_reason IS NOT NULL AS skipped, result,
+         coalesce(error, '') AS error, coalesce(skip_reason, '') AS skip_reason
+  FROM gue_child_outcomes
+  WHERE parent_id = $1
+) o`, j.ID).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	var outcomes []ChildOutcome
+	if err := json.Unmarshal(data, &outcomes); err != nil {
+		return nil, fmt.Errorf("could not unmarshal child outcomes: %w", err)
+	}
+
+	return outcomes, nil
+}
+
+// childMaxAttempts returns the number of attempts the child job without RetrySchedule
+// is worked before it is given up.
+func (j *Job) childMaxAttempts() int32 {
+	if j.client == nil {
+		return defaultChildMaxAttempts
+	}
+	return j.client.childMaxAttempts
+}
+
+// errNoPendingChildren is the error the job is failed with when it awaits children,
+// but none of them is pending, so the job would never be resumed by the children.
+var errNoPendingChildren = errors.New("job awaits children, but has no pending children")
+
+// awaitChildren parks the job until all its pending children are finished.
+// errNoPendingChildren is returned and the job is not parked if it has no pending children.
+// Job is parked in the savepoint, so that failed parking does not abort the job transaction.
+func (j *Job) awaitChildren(ctx context.Context) error {
+	return j.inSavepoint(ctx, "gue_await_children", func() error {
+		var pending int
+		err := j.Tx().QueryRow(ctx, `UPDATE gue_jobs
+SET waiting_children = (SELECT count(*) FROM gue_jobs WHERE parent_id = $1),
+    updated_at       = $2
+WHERE job_id = $1
+RETURNING waiting_children`, j.ID, time.Now()).Scan(&pending)
+		if err != nil {
+			return err
+		}
+		if pending == 0 {
+			return errNoPendingChildren
+		}
+
+		return nil
+	})
+}
+
+// finishChild records the outcome of the child job and resumes its parent
+// if it was the last child the parent was waiting for. msg is the error of the failed
+// child or the reason the child was skipped with.
+func finishChild(ctx context.Context, q adapter.Queryable, j *Job, status childStatus, msg string) error {
+	if j.ParentID == 0 {
+		return nil
+	}
+
+	var result, errMsg, skipReason interface{}
+	if len(j.Result) > 0 {
+		result = j.Result
+	}
+	switch status {
+	case childFailed:
+		if msg != "" {
+			errMsg = msg
+		}
+	case childSkipped:
+		skipReason = msg
+	}
+
+	now := time.Now()
+	_, err := q.Exec(ctx, `INSERT INTO gue_child_outcomes
+(parent_id, child_id, job_type, succeeded, result, error, skip_reason, finished_at)
+VALUES
+($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (parent_id, child_id) DO NOTHING`, j.ParentID, j.ID, j.Type, status != childFailed, result, errMsg, skipReason, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(ctx, `UPDATE gue_jobs
+SET waiting_children = waiting_children - 1,
+    updated_at       = $1
+WHERE job_id = $2 AND waiting_children > 0`, now, j.ParentID)
+
+	return err
+}
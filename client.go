@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/vgarvardt/gue/v2/adapter"
@@ -23,6 +24,33 @@ type Client struct {
 	logger  adapter.Logger
 	id      string
 	backoff Backoff
+	budget  *connBudget
+
+	inlineWM    WorkMap
+	inlineMode  InlineMode
+	inlineTimer bool
+	inline      *inlineRunner
+
+	spool       *spool
+	spoolKeyTTL time.Duration
+	shedder     shedder
+
+	aliases        TypeAliases
+	enqueueAliases bool
+
+	memoTTL map[string]time.Duration
+	quotas  map[string]QuotaPolicy
+	secrets SecretProvider
+	guards  map[string]GuardFunc
+
+	guardSQL map[string]string
+
+	childMaxAttempts int32
+	failureHistory   int
+
+	host              string
+	antiAffinity      bool
+	antiAffinityGrace time.Duration
 }
 
 // NewClient creates a new Client that uses the pgx pool.
@@ -41,14 +69,72 @@ func NewClient(pool adapter.ConnPool, options ...ClientOption) *Client {
 		instance.id = newID()
 	}
 
+	if instance.spoolKeyTTL <= 0 {
+		instance.spoolKeyTTL = defaultSpoolKeyTTL
+	}
+
+	if instance.childMaxAttempts <= 0 {
+		instance.childMaxAttempts = defaultChildMaxAttempts
+	}
+
+	if instance.failureHistory <= 0 {
+		instance.failureHistory = defaultFailureHistory
+	}
+
+	if instance.host == "" {
+		instance.host, _ = os.Hostname()
+	}
+
 	instance.logger = instance.logger.With(adapter.F("client-id", instance.id))
 
+	if instance.inlineWM != nil {
+		instance.inline = newInlineRunner(&instance, instance.inlineWM, instance.inlineMode, instance.inlineTimer)
+	}
+
 	return &instance
 }
 
 // Enqueue adds a job to the queue.
+//
+// When spool is configured and the job can not be enqueued because of the database error,
+// the job is written to the local spool instead and no error is returned. Spooled job
+// ID is not set, as the job gets it only when it is replayed.
 func (c *Client) Enqueue(ctx context.Context, j *Job) error {
-	return c.execEnqueue(ctx, j, c.pool)
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if c.spool != nil && j.spoolKey == "" {
+		// invalid job would never be replayed, so it is rejected before being spooled
+		if _, err := c.prepareEnqueue(j); err != nil {
+			return err
+		}
+		if j.spoolKey, err = newSpoolKey(); err != nil {
+			return fmt.Errorf("could not generate job spool key: %w", err)
+		}
+	}
+
+	if err := c.enqueue(ctx, j); err != nil {
+		if c.spool == nil || ctx.Err() != nil || !isUnavailable(err) {
+			return err
+		}
+
+		if spoolErr := c.spool.write(j); spoolErr != nil {
+			return fmt.Errorf("could not spool a job (spool error: %v): %w", spoolErr, err)
+		}
+
+		c.logger.Error("Failed to enqueue a job, job is spooled", adapter.Err(err), adapter.F("queue", j.Queue), adapter.F("type", j.Type))
+		return nil
+	}
+
+	if c.inline != nil {
+		release()
+		c.inline.enqueued(ctx, j)
+	}
+
+	return nil
 }
 
 // EnqueueTx adds a job to the queue within the scope of the transaction.
@@ -56,32 +142,122 @@ func (c *Client) Enqueue(ctx context.Context, j *Job) error {
 // rolled back atomically with other changes in the course of this transaction.
 //
 // It is the caller's responsibility to Commit or Rollback the transaction after
-// this function is called.
+// this function is called. In inline mode pass the job to InlineAfterCommit after
+// the transaction is committed to work it inline.
 func (c *Client) EnqueueTx(ctx context.Context, j *Job, tx adapter.Tx) error {
 	return c.execEnqueue(ctx, j, tx)
 }
 
-func (c *Client) execEnqueue(ctx context.Context, j *Job, q adapter.Queryable) error {
+// jobValues are the job values validated and converted to the DB representation
+// the same way for single jobs and EnqueueFromQuery templates.
+type jobValues struct {
+	jobType       string
+	runAt         time.Time
+	retrySchedule interface{}
+	guard         interface{}
+	parentID      interface{}
+	quotaKey      interface{}
+}
+
+// newJobValues validates the job and returns its values to be stored in the DB, the job
+// itself is not modified. Returned errors are caused by the job itself, so enqueueing
+// the job again can not succeed.
+func (c *Client) newJobValues(j *Job) (jobValues, error) {
+	var (
+		v   jobValues
+		err error
+	)
+
 	if j.Type == "" {
-		return ErrMissingType
+		return v, ErrMissingType
 	}
 
-	now := time.Now()
+	v.jobType = j.Type
+	if c.enqueueAliases {
+		v.jobType = c.aliases.Resolve(v.jobType)
+	}
 
-	runAt := j.RunAt
-	if runAt.IsZero() {
-		j.RunAt = now
+	v.runAt = j.RunAt
+	if v.runAt.IsZero() {
+		v.runAt = time.Now()
 	}
 
+	if err := j.RetrySchedule.validate(); err != nil {
+		return v, err
+	}
+	if v.retrySchedule, err = marshalRetrySchedule(j.RetrySchedule); err != nil {
+		return v, fmt.Errorf("could not marshal job retry schedule: %w", err)
+	}
+
+	if err := j.Guard.validate(); err != nil {
+		return v, err
+	}
+	if v.guard, err = marshalGuard(j.Guard); err != nil {
+		return v, fmt.Errorf("could not marshal job guard: %w", err)
+	}
+
+	if j.ParentID != 0 {
+		v.parentID = j.ParentID
+	}
+	if j.QuotaKey != "" {
+		v.quotaKey = j.QuotaKey
+	}
+
+	return v, nil
+}
+
+// prepareEnqueue validates the job, sets its defaults and returns its values
+// to be stored in the DB.
+func (c *Client) prepareEnqueue(j *Job) (jobValues, error) {
+	v, err := c.newJobValues(j)
+	if err != nil {
+		return v, err
+	}
+
+	j.Type = v.jobType
+	j.RunAt = v.runAt
 	if len(j.Args) == 0 {
 		j.Args = []byte(`[]`)
 	}
 
-	err := q.QueryRow(ctx, `INSERT INTO gue_jobs
-(queue, priority, run_at, job_type, args, created_at, updated_at)
-VALUES
-($1, $2, $3, $4, $5, $6, $6) RETURNING job_id
-`, j.Queue, j.Priority, j.RunAt, j.Type, j.Args, now).Scan(&j.ID)
+	return v, nil
+}
+
+func (c *Client) execEnqueue(ctx context.Context, j *Job, q adapter.Queryable) error {
+	v, err := c.prepareEnqueue(j)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	// quota policy may defer the job, so job RunAt is used below
+	if err := c.checkQuota(ctx, j, q); err != nil {
+		return err
+	}
+
+	var spoolKey, spoolKeyExpiresAt interface{}
+	if j.spoolKey != "" {
+		spoolKey = j.spoolKey
+		spoolKeyExpiresAt = now.Add(c.spoolKeyTTL)
+	}
+
+	// spool key is kept after the job is worked and deleted, so that replaying the job
+	// that was actually enqueued does not create a duplicate
+	err = q.QueryRow(ctx, `WITH spool_key AS (
+  INSERT INTO gue_spool_keys (spool_key, expires_at)
+  SELECT $7::text, $12::timestamptz
+  WHERE $7::text IS NOT NULL
+  ON CONFLICT (spool_key) DO NOTHING
+  RETURNING spool_key
+)
+INSERT INTO gue_jobs
+(queue, priority, run_at, job_type, args, retry_schedule, spool_key, parent_id, quota_key, guard, created_at, updated_at)
+SELECT $1::text, $2::smallint, $3::timestamptz, $4::text, $5::json, $6::json, $7::text, $8::bigint, $9::text, $10::json, $11::timestamptz, $11::timestamptz
+WHERE $7::text IS NULL OR EXISTS (SELECT 1 FROM spool_key)
+ON CONFLICT (spool_key) WHERE spool_key IS NOT NULL DO NOTHING
+RETURNING job_id
+`, j.Queue, j.Priority, j.RunAt, j.Type, j.Args, v.retrySchedule, spoolKey, v.parentID, v.quotaKey, v.guard, now, spoolKeyExpiresAt).Scan(&j.ID)
 
 	c.logger.Debug(
 		"Tried to enqueue a job",
@@ -93,7 +269,97 @@ VALUES
 	return err
 }
 
+// EnqueueFromQueryResult describes jobs created by EnqueueFromQuery.
+//
+// Job IDs are allocated from the sequence, so concurrent enqueues may interleave
+// and the range between MinID and MaxID is not guaranteed to be contiguous.
+type EnqueueFromQueryResult struct {
+	// Count is the number of jobs enqueued, that is the number of rows selected by the query.
+	Count int64
+	// MinID is the smallest ID of enqueued jobs, zero if no jobs were enqueued.
+	MinID int64
+	// MaxID is the largest ID of enqueued jobs, zero if no jobs were enqueued.
+	MaxID int64
+}
+
+// EnqueueFromQuery adds one job to the queue for every row returned by the sql query.
+// Jobs are inserted server-side with a single INSERT ... SELECT statement, so rows
+// never travel to the client.
+//
+// Queue, Priority, RunAt, Type, RetrySchedule, Guard, ParentID and QuotaKey are taken
+// from the template job, Args of every job is the selected row represented as JSON object
+// with column names as keys. ErrQuotaFromQuery is returned if the template has QuotaKey
+// set and the queue has quota policy configured with WithClientQueueQuota.
+// Query arguments should be referenced positionally from the sql string as $1, $2, etc.
+func (c *Client) EnqueueFromQuery(ctx context.Context, sql string, args []interface{}, template *Job) (EnqueueFromQueryResult, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return EnqueueFromQueryResult{}, err
+	}
+	defer release()
+
+	return c.execEnqueueFromQuery(ctx, sql, args, template, c.pool)
+}
+
+// EnqueueFromQueryTx adds jobs to the queue for every row returned by the sql query
+// within the scope of the transaction.
+//
+// It is the caller's responsibility to Commit or Rollback the transaction after
+// this function is called.
+func (c *Client) EnqueueFromQueryTx(ctx context.Context, sql string, args []interface{}, template *Job, tx adapter.Tx) (EnqueueFromQueryResult, error) {
+	return c.execEnqueueFromQuery(ctx, sql, args, template, tx)
+}
+
+func (c *Client) execEnqueueFromQuery(ctx context.Context, sql string, args []interface{}, template *Job, q adapter.Queryable) (EnqueueFromQueryResult, error) {
+	var result EnqueueFromQueryResult
+
+	v, err := c.newJobValues(template)
+	if err != nil {
+		return result, err
+	}
+	if _, ok := c.quotas[template.Queue]; ok && template.QuotaKey != "" {
+		return result, ErrQuotaFromQuery
+	}
+
+	now := time.Now()
+
+	// template values are referenced after the query arguments, so that the query
+	// placeholders remain untouched
+	n := len(args)
+	queryArgs := make([]interface{}, 0, n+9)
+	queryArgs = append(queryArgs, args...)
+	queryArgs = append(queryArgs, template.Queue, template.Priority, v.runAt, v.jobType, v.retrySchedule, now, v.guard, v.parentID, v.quotaKey)
+
+	err = q.QueryRow(ctx, fmt.Sprintf(`WITH src AS (
+%s
+), ins AS (
+INSERT INTO gue_jobs
+(queue, priority, run_at, job_type, args, retry_schedule, guard, parent_id, quota_key, created_at, updated_at)
+SELECT $%[2]d::text, $%[3]d::smallint, $%[4]d::timestamptz, $%[5]d::text, row_to_json(src), $%[6]d::json, $%[8]d::json,
+       $%[9]d::bigint, $%[10]d::text, $%[7]d::timestamptz, $%[7]d::timestamptz
+FROM src
+RETURNING job_id
+)
+SELECT count(*), coalesce(min(job_id), 0), coalesce(max(job_id), 0) FROM ins`, sql, n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9), queryArgs...).Scan(
+		&result.Count,
+		&result.MinID,
+		&result.MaxID,
+	)
+
+	c.logger.Debug(
+		"Tried to enqueue jobs from query",
+		adapter.Err(err),
+		adapter.F("queue", template.Queue),
+		adapter.F("type", v.jobType),
+		adapter.F("count", result.Count),
+	)
+
+	return result, err
+}
+
 // LockJob attempts to retrieve a Job from the database in the specified queue.
+// Queue can be the wildcard pattern, e.g. "emails.*", to retrieve a Job from
+// any queue below the hierarchy level.
 // If a job is found, it will be locked on the transactional level, so other workers
 // will be skipping it. If no job is found, nil will be returned instead of an error.
 //
@@ -103,19 +369,58 @@ VALUES
 //
 // After the Job has been worked, you must call either Done() or Error() on it
 // in order to commit transaction to persist Job changes (remove or update it).
+//
+// When connections budget is configured, LockJob blocks until worker connection
+// slot is available. When retry anti-affinity is enabled, LockJob skips jobs
+// that failed on the client host for the grace period.
 func (c *Client) LockJob(ctx context.Context, queue string) (*Job, error) {
+	now := time.Now()
+	cond, args := queueCondition(queue, 0)
+	args = append(args, now)
+	where := fmt.Sprintf("WHERE %s AND run_at <= $%d AND waiting_children = 0", cond, len(args))
+
+	if c.antiAffinity {
+		// retries are not handed to the host that failed the job unless they are
+		// waiting for other hosts longer than the grace period
+		args = append(args, c.host, now.Add(-c.antiAffinityGrace))
+		where += fmt.Sprintf(" AND (last_failed_host IS NULL OR last_failed_host <> $%d OR run_at <= $%d)", len(args)-1, len(args))
+	}
+
+	return c.execLockJob(ctx, where+`
+ORDER BY priority ASC
+LIMIT 1 FOR UPDATE SKIP LOCKED`, args...)
+}
+
+// LockJobByID attempts to retrieve a specific Job from the database by its ID regardless
+// of its queue and scheduled time. If the job does not exist or is already locked,
+// nil will be returned instead of an error.
+//
+// After the Job has been worked, you must call either Done() or Error() on it
+// in order to commit transaction to persist Job changes (remove or update it).
+func (c *Client) LockJobByID(ctx context.Context, id int64) (*Job, error) {
+	return c.execLockJob(ctx, `WHERE job_id = $1 FOR UPDATE SKIP LOCKED`, id)
+}
+
+func (c *Client) execLockJob(ctx context.Context, where string, args ...interface{}) (*Job, error) {
+	release, err := c.budget.acquire(ctx, ConnClassWorker)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := c.pool.Begin(ctx)
 	if err != nil {
+		release()
 		return nil, err
 	}
 
-	j := Job{pool: c.pool, tx: tx, backoff: c.backoff}
+	j := Job{pool: c.pool, tx: tx, backoff: c.backoff, release: release, client: c, host: c.host}
 
-	err = tx.QueryRow(ctx, `SELECT job_id, queue, priority, run_at, job_type, args, error_count
+	var retrySchedule, guard, failures []byte
+	err = tx.QueryRow(ctx, `SELECT job_id, queue, priority, run_at, job_type, args, error_count, retry_schedule,
+       last_failed_host, last_failed_worker, coalesce(parent_id, 0), coalesce(quota_key, ''), guard, failures,
+       EXISTS (SELECT 1 FROM gue_child_outcomes o WHERE o.parent_id = gue_jobs.job_id)
 FROM gue_jobs
-WHERE queue = $1 AND run_at <= $2
-ORDER BY priority ASC
-LIMIT 1 FOR UPDATE SKIP LOCKED`, queue, time.Now()).Scan(
+`+where, args...).Scan(
 		&j.ID,
 		&j.Queue,
 		&j.Priority,
@@ -123,12 +428,29 @@ LIMIT 1 FOR UPDATE SKIP LOCKED`, queue, time.Now()).Scan(
 		&j.Type,
 		&j.Args,
 		&j.ErrorCount,
+		&retrySchedule,
+		&j.LastFailedHost,
+		&j.LastFailedWorker,
+		&j.ParentID,
+		&j.QuotaKey,
+		&guard,
+		&failures,
+		&j.hasChildOutcomes,
 	)
 	if err == nil {
-		return &j, nil
+		if j.RetrySchedule, err = unmarshalRetrySchedule(retrySchedule); err != nil {
+			err = fmt.Errorf("could not unmarshal job retry schedule: %w", err)
+		} else if j.Guard, err = unmarshalGuard(guard); err != nil {
+			err = fmt.Errorf("could not unmarshal job guard: %w", err)
+		} else if j.Failures, err = unmarshalJobFailures(failures); err != nil {
+			err = fmt.Errorf("could not unmarshal job failures: %w", err)
+		} else {
+			return &j, nil
+		}
 	}
 
 	rbErr := tx.Rollback(ctx)
+	release()
 	if err == adapter.ErrNoRows {
 		return nil, rbErr
 	}
@@ -136,6 +458,12 @@ LIMIT 1 FOR UPDATE SKIP LOCKED`, queue, time.Now()).Scan(
 	return nil, fmt.Errorf("could not lock a job (rollback result: %v): %w", rbErr, err)
 }
 
+// ConnStats returns connections budget usage statistics for the given class.
+// Zero value is returned if connections budget is not configured for the client.
+func (c *Client) ConnStats(class ConnClass) ConnClassStats {
+	return c.budget.snapshot(class)
+}
+
 func newID() string {
 	hasher := md5.New()
 	// nolint:errcheck
@@ -1,6 +1,11 @@
 package gue
 
-import "github.com/vgarvardt/gue/v2/adapter"
+import (
+	"fmt"
+	"time"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
 
 // ClientOption defines a type that allows to set client properties during the build-time.
 type ClientOption func(*Client)
@@ -26,3 +31,208 @@ func WithClientBackoff(backoff Backoff) ClientOption {
 		c.backoff = backoff
 	}
 }
+
+// WithClientConnBudget limits the number of connections that client operations can hold
+// at the same time, so that workers can not exhaust the whole connections pool and
+// block enqueueing. poolSize should match the size of the underlying connections pool,
+// workerShare is the fraction of the pool (0..1] available for workers, the rest is
+// always reserved for enqueueing and administrative operations. At least one connection
+// is reserved for them even if workerShare is 1, so poolSize must be at least 2.
+func WithClientConnBudget(poolSize int, workerShare float64) ClientOption {
+	if poolSize < 2 {
+		panic(fmt.Sprintf("gue: connections budget pool size must be at least 2, got %d", poolSize))
+	}
+
+	return func(c *Client) {
+		c.budget = newConnBudget(poolSize, workerShare)
+	}
+}
+
+// WithClientInline enables inline execution mode, useful for development. In this mode
+// every job enqueued by the client is worked right away using handlers from the WorkMap,
+// without starting workers. Jobs are stored in the DB and worked using regular Worker flow,
+// so failed jobs are rescheduled with backoff as usual. Jobs of types missing in the WorkMap
+// are left to regular workers.
+//
+// Jobs enqueued with EnqueueTx are worked only when passed to Client.InlineAfterCommit
+// after the transaction is committed.
+//
+// WithClientInline panics if mode is neither InlineSync nor InlineAsync.
+func WithClientInline(wm WorkMap, mode InlineMode) ClientOption {
+	if !mode.valid() {
+		panic(fmt.Sprintf("gue: unknown inline mode %d", mode))
+	}
+
+	return func(c *Client) {
+		c.inlineWM = wm
+		c.inlineMode = mode
+	}
+}
+
+// WithClientInlineTimer makes inline execution mode honour job RunAt - jobs scheduled in the future
+// and rescheduled failed jobs are worked by timer at their RunAt. Without timer these jobs
+// are left to regular workers.
+func WithClientInlineTimer() ClientOption {
+	return func(c *Client) {
+		c.inlineTimer = true
+	}
+}
+
+// WithClientSpool enables durable local spool for jobs that failed to be enqueued with Enqueue
+// because of the database error. Such jobs are appended to the file at path and replayed
+// with the given interval once the replayer is started with Client.StartSpoolReplayer.
+// Jobs enqueued within a transaction are never spooled.
+func WithClientSpool(path string, replayInterval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.spool = newSpool(path, replayInterval)
+	}
+}
+
+// WithClientSpoolKeyTTL sets how long spool keys of the enqueued jobs are kept in the DB
+// to prevent duplicates on replay, defaults to 24 hours. Jobs spooled for longer than the TTL
+// may be enqueued twice if the original enqueue attempt actually succeeded.
+func WithClientSpoolKeyTTL(ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.spoolKeyTTL = ttl
+	}
+}
+
+// WithClientFailureHistory sets the number of the last failed attempts kept in Job.Failures,
+// defaults to 10. Older attempts are dropped, so that history of the job retried forever
+// does not grow without limit.
+func WithClientFailureHistory(n int) ClientOption {
+	return func(c *Client) {
+		c.failureHistory = n
+	}
+}
+
+// WithClientChildMaxAttempts sets the number of attempts child jobs spawned with
+// Job.SpawnChild and not having RetrySchedule are worked before they are given up,
+// defaults to 25.
+func WithClientChildMaxAttempts(n int) ClientOption {
+	return func(c *Client) {
+		c.childMaxAttempts = int32(n)
+	}
+}
+
+// WithClientShedPolicy sets load shedding policy for the queue. Workers of the client shed
+// low priority jobs of the queue according to the policy when the queue falls behind.
+//
+// WithClientShedPolicy panics if policy Action is not set, ShedDefer action policy has no
+// positive DeferBy set or ShedMove action policy has no OverflowQueue set or it is the queue itself.
+func WithClientShedPolicy(queue string, policy ShedPolicy) ClientOption {
+	switch policy.Action {
+	case ShedDiscard:
+	case ShedDefer:
+		if policy.DeferBy <= 0 {
+			panic(fmt.Sprintf("gue: shed policy for queue %q must have positive defer delay", queue))
+		}
+	case ShedMove:
+		if policy.OverflowQueue == "" || policy.OverflowQueue == queue {
+			panic(fmt.Sprintf("gue: shed policy for queue %q must have overflow queue other than the queue itself", queue))
+		}
+	default:
+		panic(fmt.Sprintf("gue: unknown shed action %d for queue %q", policy.Action, queue))
+	}
+
+	return func(c *Client) {
+		c.shedder.setPolicy(queue, policy)
+	}
+}
+
+// WithClientTypeAliases sets job type aliases, that are used by workers to dispatch jobs
+// of the old types to the handlers of the new types.
+func WithClientTypeAliases(aliases TypeAliases) ClientOption {
+	return func(c *Client) {
+		c.aliases = aliases
+	}
+}
+
+// WithClientEnqueueTypeAliases makes client rewrite old job types to the new ones using
+// type aliases on enqueue.
+func WithClientEnqueueTypeAliases() ClientOption {
+	return func(c *Client) {
+		c.enqueueAliases = true
+	}
+}
+
+// WithClientMemoize enables result memoization for the job type. Result of the successfully
+// worked job is cached in the DB for ttl, keyed by the job type and args. Identical jobs
+// worked within ttl complete immediately with the cached Result without running the handler.
+func WithClientMemoize(jobType string, ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		if c.memoTTL == nil {
+			c.memoTTL = make(map[string]time.Duration)
+		}
+		c.memoTTL[jobType] = ttl
+	}
+}
+
+// WithClientQueueQuota sets the quota policy limiting the number of pending jobs
+// per Job.QuotaKey in the queue. Quota is checked by Client.Enqueue and Client.EnqueueTx.
+// EnqueueTx locks the quota key counter till the end of the transaction, so keep such
+// transactions short.
+func WithClientQueueQuota(queue string, policy QuotaPolicy) ClientOption {
+	return func(c *Client) {
+		if c.quotas == nil {
+			c.quotas = make(map[string]QuotaPolicy)
+		}
+		c.quotas[queue] = policy
+	}
+}
+
+// WithClientSecretProvider sets the provider resolving secret references in job args,
+// see SecretRef. Secrets are resolved right before the job handler is called and resolved
+// values are redacted from job errors.
+func WithClientSecretProvider(p SecretProvider) ClientOption {
+	return func(c *Client) {
+		c.secrets = p
+	}
+}
+
+// WithClientGuard registers the predicate checking job guards with the name, see Guard.
+func WithClientGuard(name string, fn GuardFunc) ClientOption {
+	return func(c *Client) {
+		if c.guards == nil {
+			c.guards = make(map[string]GuardFunc)
+		}
+		c.guards[name] = fn
+		delete(c.guardSQL, name)
+	}
+}
+
+// WithClientGuardSQL registers the SQL check of job guards with the name, see Guard.
+// The query must return single boolean value, the job is worked if it is true and skipped
+// if it is false or the query returns no rows, e.g. "SELECT NOT completed FROM reminders
+// WHERE id = $1::text::bigint". Guard Args are passed to the query as text.
+func WithClientGuardSQL(name, sql string) ClientOption {
+	if sql == "" {
+		panic(fmt.Sprintf("gue: SQL of the guard %q must be set", name))
+	}
+
+	return func(c *Client) {
+		if c.guardSQL == nil {
+			c.guardSQL = make(map[string]string)
+		}
+		c.guardSQL[name] = sql
+		delete(c.guards, name)
+	}
+}
+
+// WithClientHost overrides host name used to identify the client workers,
+// defaults to the host name reported by the kernel.
+func WithClientHost(host string) ClientOption {
+	return func(c *Client) {
+		c.host = host
+	}
+}
+
+// WithClientRetryAntiAffinity makes client workers avoid retrying jobs that failed on the same host,
+// as failures may be host-specific. Such jobs are still retried on the same host if no other
+// host picked them up within grace period after they became ready.
+func WithClientRetryAntiAffinity(grace time.Duration) ClientOption {
+	return func(c *Client) {
+		c.antiAffinity = true
+		c.antiAffinityGrace = grace
+	}
+}
@@ -1,12 +1,16 @@
 package gue
 
 import (
+	"context"
+	"encoding/json"
+	"os"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/vgarvardt/gue/v2/adapter"
 	"github.com/vgarvardt/gue/v2/adapter/exponential"
@@ -55,3 +59,97 @@ func TestWithClientBackoff(t *testing.T) {
 	assert.Equal(t, customBackoff(123), clientWithCustomBackoff.backoff(123))
 	assert.NotEqual(t, defaultPtr, customPtr)
 }
+
+func TestWithClientConnBudget(t *testing.T) {
+	clientWithoutBudget := NewClient(nil)
+	assert.Nil(t, clientWithoutBudget.budget)
+	assert.Equal(t, ConnClassStats{}, clientWithoutBudget.ConnStats(ConnClassWorker))
+
+	clientWithBudget := NewClient(nil, WithClientConnBudget(10, 0.8))
+	assert.Equal(t, 8, clientWithBudget.ConnStats(ConnClassWorker).Limit)
+	assert.Equal(t, 10, clientWithBudget.ConnStats(ConnClassProducer).Limit)
+
+	// producers always have a connection reserved
+	clientWithFullShare := NewClient(nil, WithClientConnBudget(2, 1))
+	assert.Equal(t, 1, clientWithFullShare.ConnStats(ConnClassWorker).Limit)
+
+	assert.PanicsWithValue(t, "gue: connections budget pool size must be at least 2, got 1", func() {
+		WithClientConnBudget(1, 0.5)
+	})
+}
+
+func TestWithClientInline(t *testing.T) {
+	clientWithoutInline := NewClient(nil)
+	assert.Nil(t, clientWithoutInline.inline)
+
+	wm := WorkMap{"MyJob": nilWorker}
+	clientWithInline := NewClient(nil, WithClientInline(wm, InlineAsync), WithClientInlineTimer())
+	require.NotNil(t, clientWithInline.inline)
+	assert.Equal(t, InlineAsync, clientWithInline.inline.mode)
+	assert.True(t, clientWithInline.inline.timer)
+	assert.Contains(t, clientWithInline.inline.w.wm, "MyJob")
+
+	assert.PanicsWithValue(t, "gue: unknown inline mode 0", func() {
+		WithClientInline(wm, 0)
+	})
+}
+
+func TestWithClientHost(t *testing.T) {
+	clientWithDefaultHost := NewClient(nil)
+	host, _ := os.Hostname()
+	assert.Equal(t, host, clientWithDefaultHost.host)
+
+	clientWithCustomHost := NewClient(nil, WithClientHost("pod-1"), WithClientRetryAntiAffinity(time.Minute))
+	assert.Equal(t, "pod-1", clientWithCustomHost.host)
+	assert.True(t, clientWithCustomHost.antiAffinity)
+	assert.Equal(t, time.Minute, clientWithCustomHost.antiAffinityGrace)
+}
+
+func TestWithClientShedPolicy(t *testing.T) {
+	c := NewClient(nil, WithClientShedPolicy("emails", ShedPolicy{Action: ShedMove, OverflowQueue: "emails.overflow"}))
+	require.Contains(t, c.shedder.queues, "emails")
+	assert.Equal(t, defaultShedCheckInterval, c.shedder.queues["emails"].policy.CheckInterval)
+
+	assert.Panics(t, func() {
+		WithClientShedPolicy("emails", ShedPolicy{Action: ShedMove})
+	})
+	assert.Panics(t, func() {
+		WithClientShedPolicy("emails", ShedPolicy{Action: ShedMove, OverflowQueue: "emails"})
+	})
+	assert.Panics(t, func() {
+		WithClientShedPolicy("emails", ShedPolicy{Action: ShedDefer})
+	})
+	assert.PanicsWithValue(t, `gue: unknown shed action 0 for queue "emails"`, func() {
+		WithClientShedPolicy("emails", ShedPolicy{MaxBacklog: 100})
+	})
+}
+
+func TestWithClientFailureHistory(t *testing.T) {
+	clientWithDefaultHistory := NewClient(nil)
+	assert.Equal(t, defaultFailureHistory, clientWithDefaultHistory.failureHistory)
+
+	clientWithCustomHistory := NewClient(nil, WithClientFailureHistory(3))
+	assert.Equal(t, 3, clientWithCustomHistory.failureHistory)
+}
+
+func TestWithClientChildMaxAttempts(t *testing.T) {
+	clientWithDefaultMaxAttempts := NewClient(nil)
+	assert.Equal(t, int32(defaultChildMaxAttempts), clientWithDefaultMaxAttempts.childMaxAttempts)
+
+	clientWithCustomMaxAttempts := NewClient(nil, WithClientChildMaxAttempts(3))
+	assert.Equal(t, int32(3), clientWithCustomMaxAttempts.childMaxAttempts)
+}
+
+func TestWithClientGuardSQL(t *testing.T) {
+	guard := func(ctx context.Context, j *Job, params json.RawMessage) (bool, error) {
+		return true, nil
+	}
+
+	c := NewClient(nil, WithClientGuard("pending", guard), WithClientGuardSQL("pending", "SELECT true"))
+	assert.Equal(t, "SELECT true", c.guardSQL["pending"])
+	assert.NotContains(t, c.guards, "pending")
+
+	assert.PanicsWithValue(t, `gue: SQL of the guard "pending" must be set`, func() {
+		WithClientGuardSQL("pending", "")
+	})
+}
@@ -2,6 +2,7 @@ package gue
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -405,6 +406,56 @@ func testJobErrorCustomBackoff(t *testing.T, connPool adapter.ConnPool) {
 	assert.Equal(t, job.RunAt.Add(time.Hour).Unix(), j2.RunAt.Unix())
 }
 
+func TestJobErrorRetrySchedule(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testJobErrorRetrySchedule(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testJobErrorRetrySchedule(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testJobErrorRetrySchedule(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testJobErrorRetrySchedule(t *testing.T, connPool adapter.ConnPool) {
+	// client-wide backoff must not be used for jobs with retry schedule
+	customBackoff := func(retries int) time.Duration {
+		return time.Duration(retries) * time.Hour
+	}
+
+	c := NewClient(connPool, WithClientBackoff(customBackoff))
+	ctx := context.Background()
+
+	job := &Job{Type: "MyJob", RetrySchedule: &RetrySchedule{Delays: []time.Duration{-time.Minute}}}
+	err := c.Enqueue(ctx, job)
+	require.NoError(t, err)
+
+	j, err := c.LockJob(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, j)
+	assert.Equal(t, job.RetrySchedule, j.RetrySchedule)
+
+	err = j.Error(ctx, "first failure")
+	require.NoError(t, err)
+
+	j2 := findOneJob(t, connPool)
+	require.NotNil(t, j2)
+	assert.Equal(t, int32(1), j2.ErrorCount)
+	assert.Less(t, j2.RunAt.Unix(), job.RunAt.Unix())
+
+	// schedule is exhausted, so the job is given up
+	j, err = c.LockJob(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, j)
+
+	err = j.Error(ctx, "second failure")
+	require.NoError(t, err)
+
+	j2 = findOneJob(t, connPool)
+	assert.Nil(t, j2)
+}
+
 func findOneJob(t testing.TB, q adapter.Queryable) *Job {
 	t.Helper()
 
@@ -429,3 +480,77 @@ func findOneJob(t testing.TB, q adapter.Queryable) *Job {
 
 	return j
 }
+
+func TestLockJobRetryAntiAffinity(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testLockJobRetryAntiAffinity(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testLockJobRetryAntiAffinity(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testLockJobRetryAntiAffinity(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testLockJobRetryAntiAffinity(t *testing.T, connPool adapter.ConnPool) {
+	// failed jobs are retried right away
+	noBackoff := func(retries int) time.Duration {
+		return 0
+	}
+
+	c1 := NewClient(connPool, WithClientHost("host-1"), WithClientBackoff(noBackoff), WithClientRetryAntiAffinity(time.Hour))
+	c2 := NewClient(connPool, WithClientHost("host-2"), WithClientBackoff(noBackoff), WithClientRetryAntiAffinity(time.Hour))
+	ctx := context.Background()
+
+	err := c1.Enqueue(ctx, &Job{Type: "MyJob"})
+	require.NoError(t, err)
+
+	wm := WorkMap{
+		"MyJob": func(j *Job) error {
+			return errors.New("bad disk")
+		},
+	}
+	w1 := NewWorker(c1, wm, WithWorkerID("worker-1"))
+	assert.True(t, w1.WorkOne(ctx))
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+	assert.Equal(t, int32(1), j.ErrorCount)
+
+	// the host that failed the job does not get it during the grace period
+	j, err = c1.LockJob(ctx, "")
+	require.NoError(t, err)
+	assert.Nil(t, j)
+
+	j, err = c2.LockJob(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, j)
+	assert.Equal(t, "host-1", j.LastFailedHost.String)
+	assert.Equal(t, "worker-1", j.LastFailedWorker.String)
+	require.Len(t, j.Failures, 1)
+	assert.Equal(t, int32(1), j.Failures[0].Attempt)
+	assert.Equal(t, "host-1", j.Failures[0].Host)
+	assert.Equal(t, "worker-1", j.Failures[0].Worker)
+	assert.Equal(t, "bad disk", j.Failures[0].Error)
+
+	// every failed attempt is kept in the history
+	require.NoError(t, j.Error(ctx, "bad network"))
+	j, err = c1.LockJob(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, j)
+	require.Len(t, j.Failures, 2)
+	assert.Equal(t, "bad disk", j.Failures[0].Error)
+	assert.Equal(t, int32(2), j.Failures[1].Attempt)
+	assert.Equal(t, "host-2", j.Failures[1].Host)
+	assert.Equal(t, "bad network", j.Failures[1].Error)
+	assert.Equal(t, "host-2", j.LastFailedHost.String)
+	require.NoError(t, j.Done(ctx))
+
+	// without anti-affinity the job is handed to any host
+	c3 := NewClient(connPool, WithClientHost("host-1"))
+	j, err = c3.LockJob(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, j)
+	require.NoError(t, j.Done(ctx))
+}
@@ -0,0 +1,170 @@
+package gue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ConnClass is the class of operations sharing connections budget.
+type ConnClass int
+
+const (
+	// ConnClassWorker is the class of worker operations - locking and working jobs.
+	// Worker holds a connection and a transaction for the whole time the job is being worked.
+	ConnClassWorker ConnClass = iota
+	// ConnClassProducer is the class of short-living operations - enqueueing jobs
+	// and administrative operations.
+	ConnClassProducer
+)
+
+// String returns human-readable connection class name
+func (c ConnClass) String() string {
+	switch c {
+	case ConnClassWorker:
+		return "worker"
+	case ConnClassProducer:
+		return "producer"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnClassStats is the snapshot of connections budget usage by a single class.
+type ConnClassStats struct {
+	// Limit is the maximum number of connections the class may hold at the same time.
+	Limit int
+	// InUse is the number of connections currently held by the class.
+	InUse int
+	// Acquired is the total number of connections acquired by the class.
+	Acquired int64
+	// Waited is the number of acquisitions that had to wait for a free slot.
+	Waited int64
+	// WaitTime is the total time spent waiting for a free slot.
+	WaitTime time.Duration
+	// MaxWaitTime is the longest time spent waiting for a free slot.
+	MaxWaitTime time.Duration
+}
+
+// connBudget splits connection pool between workers and producers, so that
+// workers can never exhaust the whole pool. Every operation takes a slot from
+// the shared pool-wide semaphore, worker operations additionally take a slot from
+// the worker semaphore first. At least one slot is always left to producers, so that
+// job handlers enqueueing jobs can not be blocked by workers holding the whole pool.
+type connBudget struct {
+	total  chan struct{}
+	worker chan struct{}
+
+	mu    sync.Mutex
+	stats map[ConnClass]*ConnClassStats
+}
+
+func newConnBudget(poolSize int, workerShare float64) *connBudget {
+	if poolSize < 2 {
+		poolSize = 2
+	}
+
+	workerLimit := int(float64(poolSize) * workerShare)
+	if workerLimit < 1 {
+		workerLimit = 1
+	}
+	if workerLimit > poolSize-1 {
+		workerLimit = poolSize - 1
+	}
+
+	return &connBudget{
+		total:  make(chan struct{}, poolSize),
+		worker: make(chan struct{}, workerLimit),
+		stats: map[ConnClass]*ConnClassStats{
+			ConnClassWorker:   {Limit: workerLimit},
+			ConnClassProducer: {Limit: poolSize},
+		},
+	}
+}
+
+// acquire blocks until connection slot for the class is available or context is cancelled.
+// Returned release function must be called once the connection is returned to the pool.
+// nil budget does not limit anything.
+func (b *connBudget) acquire(ctx context.Context, class ConnClass) (release func(), err error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	waited := false
+
+	if class == ConnClassWorker {
+		w, err := b.take(ctx, b.worker)
+		if err != nil {
+			return nil, err
+		}
+		waited = waited || w
+	}
+
+	w, err := b.take(ctx, b.total)
+	if err != nil {
+		if class == ConnClassWorker {
+			<-b.worker
+		}
+		return nil, err
+	}
+	waited = waited || w
+
+	b.mu.Lock()
+	s := b.stats[class]
+	s.InUse++
+	s.Acquired++
+	if waited {
+		wait := time.Since(start)
+		s.Waited++
+		s.WaitTime += wait
+		if wait > s.MaxWaitTime {
+			s.MaxWaitTime = wait
+		}
+	}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-b.total
+			if class == ConnClassWorker {
+				<-b.worker
+			}
+
+			b.mu.Lock()
+			b.stats[class].InUse--
+			b.mu.Unlock()
+		})
+	}, nil
+}
+
+// take puts a token into the semaphore and reports whether it had to wait for a free slot.
+func (b *connBudget) take(ctx context.Context, sem chan struct{}) (waited bool, err error) {
+	select {
+	case sem <- struct{}{}:
+		return false, nil
+	default:
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+func (b *connBudget) snapshot(class ConnClass) ConnClassStats {
+	if b == nil {
+		return ConnClassStats{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.stats[class]; ok {
+		return *s
+	}
+	return ConnClassStats{}
+}
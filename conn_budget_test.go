@@ -0,0 +1,77 @@
+package gue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnBudget(t *testing.T) {
+	b := newConnBudget(4, 0.5)
+	ctx := context.Background()
+
+	assert.Equal(t, 2, b.snapshot(ConnClassWorker).Limit)
+	assert.Equal(t, 4, b.snapshot(ConnClassProducer).Limit)
+
+	w1, err := b.acquire(ctx, ConnClassWorker)
+	require.NoError(t, err)
+	w2, err := b.acquire(ctx, ConnClassWorker)
+	require.NoError(t, err)
+
+	// workers share is exhausted
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = b.acquire(timeoutCtx, ConnClassWorker)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// while producers still have their reserved connections
+	p1, err := b.acquire(ctx, ConnClassProducer)
+	require.NoError(t, err)
+	p2, err := b.acquire(ctx, ConnClassProducer)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, b.snapshot(ConnClassWorker).InUse)
+	assert.Equal(t, 2, b.snapshot(ConnClassProducer).InUse)
+
+	acquired := make(chan struct{})
+	go func() {
+		p3, err := b.acquire(ctx, ConnClassProducer)
+		assert.NoError(t, err)
+		p3()
+		close(acquired)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	w1()
+	// release func is idempotent
+	w1()
+	<-acquired
+
+	w2()
+	p1()
+	p2()
+
+	workerStats := b.snapshot(ConnClassWorker)
+	assert.Equal(t, 0, workerStats.InUse)
+	assert.Equal(t, int64(2), workerStats.Acquired)
+
+	producerStats := b.snapshot(ConnClassProducer)
+	assert.Equal(t, 0, producerStats.InUse)
+	assert.Equal(t, int64(3), producerStats.Acquired)
+	assert.Equal(t, int64(1), producerStats.Waited)
+	assert.Greater(t, int64(producerStats.WaitTime), int64(0))
+	assert.Equal(t, producerStats.WaitTime, producerStats.MaxWaitTime)
+}
+
+func TestConnBudgetNil(t *testing.T) {
+	var b *connBudget
+
+	release, err := b.acquire(context.Background(), ConnClassWorker)
+	require.NoError(t, err)
+	release()
+
+	assert.Equal(t, ConnClassStats{}, b.snapshot(ConnClassWorker))
+}
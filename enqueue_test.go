@@ -13,6 +13,29 @@ import (
 	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
 )
 
+func TestClientNewJobValues(t *testing.T) {
+	c := NewClient(nil, WithClientTypeAliases(TypeAliases{"OldJob": "NewJob"}), WithClientEnqueueTypeAliases())
+
+	template := &Job{Type: "OldJob", ParentID: 42}
+	v, err := c.newJobValues(template)
+	require.NoError(t, err)
+	assert.Equal(t, "NewJob", v.jobType)
+	assert.False(t, v.runAt.IsZero())
+	assert.Equal(t, int64(42), v.parentID)
+	assert.Nil(t, v.quotaKey)
+
+	// template is not modified, so it can be reused
+	assert.Equal(t, "OldJob", template.Type)
+	assert.True(t, template.RunAt.IsZero())
+
+	_, err = c.newJobValues(&Job{})
+	assert.Equal(t, ErrMissingType, err)
+	_, err = c.newJobValues(&Job{Type: "MyJob", RetrySchedule: &RetrySchedule{}})
+	assert.Equal(t, ErrInvalidRetrySchedule, err)
+	_, err = c.newJobValues(&Job{Type: "MyJob", Guard: &Guard{}})
+	assert.Equal(t, ErrInvalidGuard, err)
+}
+
 func TestEnqueueOnlyType(t *testing.T) {
 	t.Run("pgx/v3", func(t *testing.T) {
 		testEnqueueOnlyType(t, adapterTesting.OpenTestPoolPGXv3(t))
@@ -183,3 +206,115 @@ func testEnqueueTx(t *testing.T, connPool adapter.ConnPool) {
 	j = findOneJob(t, connPool)
 	require.Nil(t, j)
 }
+
+func TestEnqueueFromQuery(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testEnqueueFromQuery(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testEnqueueFromQuery(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testEnqueueFromQuery(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testEnqueueFromQuery(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool)
+	ctx := context.Background()
+
+	result, err := c.EnqueueFromQuery(
+		ctx,
+		`SELECT i AS customer_id FROM generate_series(1, $1::int) AS i`,
+		[]interface{}{3},
+		&Job{Type: "MyJob", Queue: "from-query", Priority: 5},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), result.Count)
+	assert.Greater(t, result.MinID, int64(0))
+	assert.Equal(t, result.MinID+2, result.MaxID)
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+
+	assert.Equal(t, "MyJob", j.Type)
+	assert.Equal(t, "from-query", j.Queue)
+	assert.Equal(t, int16(5), j.Priority)
+	assert.Regexp(t, `^\{"customer_id":\d\}$`, string(j.Args))
+
+	result, err = c.EnqueueFromQuery(ctx, `SELECT 1 AS id WHERE false`, nil, &Job{Type: "MyJob"})
+	require.NoError(t, err)
+	assert.Equal(t, EnqueueFromQueryResult{}, result)
+
+	_, err = c.EnqueueFromQuery(ctx, `SELECT 1 AS id`, nil, &Job{})
+	require.Equal(t, ErrMissingType, err)
+}
+
+func TestEnqueueFromQueryQuotaKey(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testEnqueueFromQueryQuotaKey(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testEnqueueFromQueryQuotaKey(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testEnqueueFromQueryQuotaKey(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testEnqueueFromQueryQuotaKey(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool, WithClientQueueQuota("limited", QuotaPolicy{MaxPending: 1}))
+	ctx := context.Background()
+
+	// quota policy is applied to jobs one by one, so it can not be applied to the query
+	_, err := c.EnqueueFromQuery(ctx, `SELECT 1 AS id`, nil, &Job{Type: "MyJob", Queue: "limited", QuotaKey: "tenant-1"})
+	require.Equal(t, ErrQuotaFromQuery, err)
+
+	result, err := c.EnqueueFromQuery(
+		ctx,
+		`SELECT i AS id FROM generate_series(1, 2) AS i`,
+		nil,
+		&Job{Type: "MyJob", Queue: "unlimited", QuotaKey: "tenant-1", ParentID: 42},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Count)
+
+	var parentID int64
+	var quotaKey string
+	err = connPool.QueryRow(ctx, `SELECT parent_id, quota_key FROM gue_jobs WHERE job_id = $1`, result.MinID).Scan(&parentID, &quotaKey)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), parentID)
+	assert.Equal(t, "tenant-1", quotaKey)
+}
+
+func TestEnqueueFromQueryTx(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testEnqueueFromQueryTx(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testEnqueueFromQueryTx(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+}
+
+func testEnqueueFromQueryTx(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool)
+	ctx := context.Background()
+
+	tx, err := connPool.Begin(ctx)
+	require.NoError(t, err)
+
+	result, err := c.EnqueueFromQueryTx(ctx, `SELECT 'foo' AS name`, nil, &Job{Type: "MyJob"}, tx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Count)
+
+	j := findOneJob(t, tx)
+	require.NotNil(t, j)
+	assert.Equal(t, []byte(`{"name":"foo"}`), j.Args)
+
+	err = tx.Rollback(ctx)
+	require.NoError(t, err)
+
+	j = findOneJob(t, connPool)
+	require.Nil(t, j)
+}
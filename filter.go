@@ -0,0 +1,456 @@
+package gue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter is the compiled job filter expression, used by administrative operations
+// to select jobs. Filter is built from the small query language with ParseFilter.
+// nil Filter matches all the jobs in read-only operations, operations changing or deleting
+// jobs return ErrNilFilter for it and require MatchAllFilter to be used explicitly.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// ErrNilFilter is returned by administrative operations changing or deleting jobs
+// when the filter is nil.
+var ErrNilFilter = errors.New("filter must be set, use MatchAllFilter to select all the jobs")
+
+// MatchAllFilter returns the filter matching all the jobs.
+func MatchAllFilter() *Filter {
+	return &Filter{}
+}
+
+// ParseFilter parses job filter expression, e.g.
+//
+//	type = "SendEmail" and error_count > 3 and args.customer_id = 42 and age > 1h
+//
+// Expression is a set of comparisons combined with "and", "or", "not" and parentheses.
+// Comparison operators are =, !=, <, <=, > and >=. Supported fields are:
+//  - id, priority and error_count - compared with integer numbers
+//  - type, queue and last_error - compared with double-quoted strings, last_error can also be compared with null
+//  - run_at and created_at - compared with RFC3339 timestamps in double-quoted strings
+//  - age - time passed since the job creation, compared with durations, e.g. 90s, 30m or 1h
+//  - args.<path> - value at the dot-separated path in job args, compared with strings, numbers, true, false or null
+//
+// Filter is compiled to parameterised SQL, so values never get into the query text.
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// MustParseFilter is like ParseFilter but panics if the expression can not be parsed.
+func MustParseFilter(expr string) *Filter {
+	f, err := ParseFilter(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// String returns source filter expression
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// where compiles the filter to SQL condition with placeholders numbered starting
+// right after argOffset.
+func (f *Filter) where(argOffset int) (string, []interface{}) {
+	if f == nil || f.root == nil {
+		return "TRUE", nil
+	}
+
+	c := &filterCompiler{offset: argOffset}
+	return f.root.compile(c), c.args
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenDuration
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var (
+	filterNumberRe   = regexp.MustCompile(`^-?\d+(\.\d+)?`)
+	filterDurationRe = regexp.MustCompile(`^(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+`)
+	filterIdentRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_-]+)*`)
+)
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for pos := 0; pos < len(expr); {
+		r := rune(expr[pos])
+		rest := expr[pos:]
+
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "(", pos: pos})
+			pos++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")", pos: pos})
+			pos++
+		case strings.HasPrefix(rest, "!=") || strings.HasPrefix(rest, "<=") || strings.HasPrefix(rest, ">="):
+			tokens = append(tokens, filterToken{kind: tokenOp, text: rest[:2], pos: pos})
+			pos += 2
+		case r == '=' || r == '<' || r == '>':
+			tokens = append(tokens, filterToken{kind: tokenOp, text: rest[:1], pos: pos})
+			pos++
+		case r == '"':
+			end := pos + 1
+			for ; end < len(expr); end++ {
+				if expr[end] == '\\' {
+					end++
+					continue
+				}
+				if expr[end] == '"' {
+					break
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at position %d", pos)
+			}
+
+			s, err := strconv.Unquote(expr[pos : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", pos, err)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: s, pos: pos})
+			pos = end + 1
+		case filterDurationRe.MatchString(rest):
+			d := filterDurationRe.FindString(rest)
+			tokens = append(tokens, filterToken{kind: tokenDuration, text: d, pos: pos})
+			pos += len(d)
+		case filterNumberRe.MatchString(rest):
+			n := filterNumberRe.FindString(rest)
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: n, pos: pos})
+			pos += len(n)
+		case filterIdentRe.MatchString(rest):
+			id := filterIdentRe.FindString(rest)
+			tokens = append(tokens, filterToken{kind: tokenIdent, text: id, pos: pos})
+			pos += len(id)
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, pos)
+		}
+	}
+
+	return append(tokens, filterToken{kind: tokenEOF, text: "end of expression", pos: len(expr)}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) keyword(kw string) bool {
+	t := p.peek()
+	if t.kind == tokenIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterBinary{op: "OR", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterBinary{op: "AND", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.keyword("not") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{expr: expr}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	t := p.next()
+
+	if t.kind == tokenLParen {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ) at position %d, got %q", t.pos, t.text)
+		}
+		return expr, nil
+	}
+
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("expected field name at position %d, got %q", t.pos, t.text)
+	}
+
+	op := p.next()
+	if op.kind != tokenOp {
+		return nil, fmt.Errorf("expected comparison operator at position %d, got %q", op.pos, op.text)
+	}
+
+	value := p.next()
+	switch value.kind {
+	case tokenString, tokenNumber, tokenDuration, tokenIdent:
+	default:
+		return nil, fmt.Errorf("expected value at position %d, got %q", value.pos, value.text)
+	}
+
+	return newFilterComparison(t, op.text, value)
+}
+
+type filterNode interface {
+	compile(c *filterCompiler) string
+}
+
+type filterCompiler struct {
+	offset int
+	args   []interface{}
+}
+
+func (c *filterCompiler) arg(v interface{}) string {
+	c.args = append(c.args, v)
+	return fmt.Sprintf("$%d", c.offset+len(c.args))
+}
+
+type filterBinary struct {
+	op          string
+	left, right filterNode
+}
+
+func (n *filterBinary) compile(c *filterCompiler) string {
+	return "(" + n.left.compile(c) + " " + n.op + " " + n.right.compile(c) + ")"
+}
+
+type filterNot struct {
+	expr filterNode
+}
+
+func (n *filterNot) compile(c *filterCompiler) string {
+	return "(NOT " + n.expr.compile(c) + ")"
+}
+
+type filterValueKind int
+
+const (
+	filterValueString filterValueKind = iota
+	filterValueInt
+	filterValueTime
+	filterValueDuration
+	filterValueJSON
+)
+
+var filterColumns = map[string]struct {
+	column   string
+	kind     filterValueKind
+	nullable bool
+}{
+	"id":          {column: "job_id", kind: filterValueInt},
+	"priority":    {column: "priority", kind: filterValueInt},
+	"error_count": {column: "error_count", kind: filterValueInt},
+	"type":        {column: "job_type", kind: filterValueString},
+	"queue":       {column: "queue", kind: filterValueString},
+	"last_error":  {column: "last_error", kind: filterValueString, nullable: true},
+	"run_at":      {column: "run_at", kind: filterValueTime},
+	"created_at":  {column: "created_at", kind: filterValueTime},
+	"age":         {column: "created_at", kind: filterValueDuration},
+}
+
+// filterComparison is a single "field op value" comparison. Value is already converted
+// to the type expected by the field.
+type filterComparison struct {
+	column string
+	op     string
+	kind   filterValueKind
+	path   string
+	value  interface{}
+}
+
+func newFilterComparison(field filterToken, op string, value filterToken) (filterNode, error) {
+	isNull := value.kind == tokenIdent && strings.EqualFold(value.text, "null")
+
+	if strings.HasPrefix(field.text, "args.") {
+		segments := strings.Split(strings.TrimPrefix(field.text, "args."), ".")
+
+		var jsonValue []byte
+		switch {
+		case value.kind == tokenString:
+			jsonValue, _ = json.Marshal(value.text)
+		case value.kind == tokenNumber:
+			jsonValue = []byte(value.text)
+		case value.kind == tokenIdent && (isNull || strings.EqualFold(value.text, "true") || strings.EqualFold(value.text, "false")):
+			jsonValue = []byte(strings.ToLower(value.text))
+		default:
+			return nil, fmt.Errorf("invalid value %q for field %q at position %d", value.text, field.text, value.pos)
+		}
+
+		return &filterComparison{
+			column: "args",
+			op:     op,
+			kind:   filterValueJSON,
+			path:   "{" + strings.Join(segments, ",") + "}",
+			value:  string(jsonValue),
+		}, nil
+	}
+
+	col, ok := filterColumns[field.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", field.text, field.pos)
+	}
+
+	cmp := &filterComparison{column: col.column, op: op, kind: col.kind}
+
+	if isNull {
+		if !col.nullable {
+			return nil, fmt.Errorf("field %q at position %d can not be null", field.text, field.pos)
+		}
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("null can be compared only with = or != at position %d", value.pos)
+		}
+		return cmp, nil
+	}
+
+	invalid := fmt.Errorf("invalid value %q for field %q at position %d", value.text, field.text, value.pos)
+	switch col.kind {
+	case filterValueString:
+		if value.kind != tokenString {
+			return nil, invalid
+		}
+		cmp.value = value.text
+	case filterValueInt:
+		if value.kind != tokenNumber {
+			return nil, invalid
+		}
+		n, err := strconv.ParseInt(value.text, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		cmp.value = n
+	case filterValueTime:
+		if value.kind != tokenString {
+			return nil, invalid
+		}
+		t, err := time.Parse(time.RFC3339Nano, value.text)
+		if err != nil {
+			return nil, invalid
+		}
+		cmp.value = t
+	case filterValueDuration:
+		if value.kind != tokenDuration && !(value.kind == tokenNumber && value.text == "0") {
+			return nil, invalid
+		}
+		d, err := time.ParseDuration(value.text)
+		if err != nil {
+			return nil, invalid
+		}
+		cmp.value = d
+	}
+
+	return cmp, nil
+}
+
+// agedOps maps age comparison to the creation time comparison
+var agedOps = map[string]string{"=": "=", "!=": "<>", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+func (n *filterComparison) compile(c *filterCompiler) string {
+	op := n.op
+	if op == "!=" {
+		op = "<>"
+	}
+
+	switch {
+	case n.value == nil && n.kind != filterValueJSON:
+		if n.op == "=" {
+			return n.column + " IS NULL"
+		}
+		return n.column + " IS NOT NULL"
+	case n.kind == filterValueJSON:
+		return fmt.Sprintf("(args::jsonb #> %s::text::text[]) %s %s::text::jsonb", c.arg(n.path), op, c.arg(n.value))
+	case n.kind == filterValueDuration:
+		return fmt.Sprintf("%s %s %s", n.column, agedOps[n.op], c.arg(time.Now().Add(-n.value.(time.Duration))))
+	default:
+		return fmt.Sprintf("%s %s %s", n.column, op, c.arg(n.value))
+	}
+}
@@ -0,0 +1,113 @@
+package gue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	f, err := ParseFilter(`type = "SendEmail" and error_count > 3 and args.customer_id = 42 and age > 1h`)
+	require.NoError(t, err)
+
+	where, args := f.where(2)
+	assert.Equal(
+		t,
+		`(((job_type = $3 AND error_count > $4) AND (args::jsonb #> $5::text::text[]) = $6::text::jsonb) AND created_at < $7)`,
+		where,
+	)
+	require.Len(t, args, 5)
+	assert.Equal(t, "SendEmail", args[0])
+	assert.Equal(t, int64(3), args[1])
+	assert.Equal(t, "{customer_id}", args[2])
+	assert.Equal(t, "42", args[3])
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), args[4].(time.Time), time.Minute)
+}
+
+func TestParseFilterPrecedence(t *testing.T) {
+	f, err := ParseFilter(`queue = "a" or not (priority <= -5 or last_error != null) and args.user.name = "x\"y"`)
+	require.NoError(t, err)
+
+	where, args := f.where(0)
+	assert.Equal(
+		t,
+		`(queue = $1 OR ((NOT (priority <= $2 OR last_error IS NOT NULL)) AND (args::jsonb #> $3::text::text[]) = $4::text::jsonb))`,
+		where,
+	)
+	assert.Equal(t, []interface{}{"a", int64(-5), "{user,name}", `"x\"y"`}, args)
+}
+
+func TestParseFilterValues(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		want interface{}
+	}{
+		{expr: `args.flag = true`, want: "true"},
+		{expr: `args.flag != null`, want: "null"},
+		{expr: `args.amount >= 12.5`, want: "12.5"},
+		{expr: `id >= 100`, want: int64(100)},
+		{expr: `created_at < "2020-06-01T12:00:00Z"`, want: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{expr: `run_at > "2020-06-01T12:00:00+02:00"`, want: time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)},
+	} {
+		f, err := ParseFilter(tc.expr)
+		require.NoError(t, err, tc.expr)
+
+		_, args := f.where(0)
+		require.NotEmpty(t, args, tc.expr)
+
+		got := args[len(args)-1]
+		if want, ok := tc.want.(time.Time); ok {
+			assert.True(t, want.Equal(got.(time.Time)), tc.expr)
+			continue
+		}
+		assert.Equal(t, tc.want, got, tc.expr)
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`type`,
+		`type =`,
+		`type = 42`,
+		`priority = "high"`,
+		`priority = 1.5`,
+		`metadata.foo = 1`,
+		`queue = null`,
+		`last_error > null`,
+		`age > 10`,
+		`run_at > "yesterday"`,
+		`type = "foo" and`,
+		`(type = "foo"`,
+		`type = "foo")`,
+		`type = "foo`,
+		`type == "foo"`,
+		`type = "foo" # comment`,
+		`AGE <= 90s`,
+	} {
+		_, err := ParseFilter(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNilFilter(t *testing.T) {
+	var f *Filter
+
+	where, args := f.where(0)
+	assert.Equal(t, "TRUE", where)
+	assert.Empty(t, args)
+	assert.Equal(t, "", f.String())
+
+	assert.Equal(t, `type = "foo"`, MustParseFilter(`type = "foo"`).String())
+	assert.Panics(t, func() {
+		MustParseFilter(`type =`)
+	})
+}
+
+func TestMatchAllFilter(t *testing.T) {
+	where, args := MatchAllFilter().where(0)
+	assert.Equal(t, "TRUE", where)
+	assert.Empty(t, args)
+}
@@ -0,0 +1,171 @@
+package gue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+// Guard is the execution guard checked before the job is worked, so that jobs
+// obsolete by the time they run, e.g. "send reminder" after the user already completed
+// the action, are skipped instead of being worked. Guard is checked by the worker
+// within the job lock transaction. Skipped jobs are listed with Client.SkippedJobs.
+//
+// Guard refers to the check registered on the client by name, either the predicate
+// registered with WithClientGuard or the SQL check registered with WithClientGuardSQL,
+// so that job rows never carry code to be run by workers.
+type Guard struct {
+	// Name is the name of the check registered with WithClientGuard or WithClientGuardSQL.
+	Name string `json:"name"`
+	// Params are the predicate parameters passed to GuardFunc as is.
+	Params json.RawMessage `json:"params,omitempty"`
+	// Args are the SQL check arguments, they are passed as text and should be cast
+	// in the query to the required types.
+	Args []string `json:"args,omitempty"`
+
+	// Reason is the human-readable reason the job is skipped with when the guard fails.
+	Reason string `json:"reason,omitempty"`
+}
+
+// SkippedJob is the record of the job that was not worked because its Guard failed.
+type SkippedJob struct {
+	// ID is the skipped job ID.
+	ID int64 `json:"job_id"`
+	// Queue is the skipped job queue.
+	Queue string `json:"queue"`
+	// Type is the skipped job type.
+	Type string `json:"job_type"`
+	// Reason is the reason the job was skipped with.
+	Reason string `json:"reason"`
+	// SkippedAt is the time the job was skipped at.
+	SkippedAt time.Time `json:"skipped_at"`
+}
+
+// GuardFunc is a function checking the named Guard. It returns false if the job should
+// be skipped. Job transaction is available with Job.Tx.
+type GuardFunc func(ctx context.Context, j *Job, params json.RawMessage) (bool, error)
+
+// ErrInvalidGuard is returned on enqueueing a job with a guard that has no name set.
+var ErrInvalidGuard = errors.New("job guard must have name set")
+
+func (g *Guard) validate() error {
+	if g == nil {
+		return nil
+	}
+	if g.Name == "" {
+		return ErrInvalidGuard
+	}
+	return nil
+}
+
+// skipReason returns the reason the job is skipped with when the guard fails.
+func (g *Guard) skipReason() string {
+	if g.Reason != "" {
+		return g.Reason
+	}
+	return fmt.Sprintf("guard %q failed", g.Name)
+}
+
+// marshalGuard returns guard representation to be stored in the DB,
+// nil guard is stored as NULL.
+func marshalGuard(g *Guard) (interface{}, error) {
+	if g == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(g)
+}
+
+func unmarshalGuard(data []byte) (*Guard, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	g := new(Guard)
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// checkGuard checks the job guard within the job transaction and returns true if the job
+// should be worked. Guard is checked in the savepoint, so that failed check does not abort
+// the job transaction.
+func (c *Client) checkGuard(ctx context.Context, j *Job) (bool, error) {
+	g := j.Guard
+	if g == nil {
+		return true, nil
+	}
+
+	fn, isFunc := c.guards[g.Name]
+	sql, isSQL := c.guardSQL[g.Name]
+	if !isFunc && !isSQL {
+		return false, fmt.Errorf("unknown job guard: %q", g.Name)
+	}
+
+	var pass bool
+	err := j.inSavepoint(ctx, "gue_guard", func() error {
+		var err error
+		if isFunc {
+			pass, err = fn(ctx, j, g.Params)
+			return err
+		}
+
+		args := make([]interface{}, len(g.Args))
+		for i := range g.Args {
+			args[i] = g.Args[i]
+		}
+		err = j.Tx().QueryRow(ctx, sql, args...).Scan(&pass)
+		if err == adapter.ErrNoRows {
+			// nothing to check against, e.g. the row the guard looks at is deleted
+			pass, err = false, nil
+		}
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not check job guard: %w", err)
+	}
+
+	return pass, nil
+}
+
+// SkippedJobs returns up to limit latest jobs of the queue skipped by workers of all the clients
+// because their guards failed, ordered by skip time, newest first.
+func (c *Client) SkippedJobs(ctx context.Context, queue string, limit int) ([]SkippedJob, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var data []byte
+	err = c.pool.QueryRow(ctx, `SELECT coalesce(json_agg(s ORDER BY s.skipped_at DESC, s.job_id DESC), '[]')::text
+FROM (
+  SELECT job_id, queue, job_type, reason, skipped_at
+  FROM gue_skipped_jobs
+  WHERE queue = $1
+  ORDER BY skipped_at DESC, job_id DESC
+  LIMIT $2
+) s`, queue, limit).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []SkippedJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("could not unmarshal skipped jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// PurgeSkippedJobs deletes records of the jobs skipped before the given time
+// and returns the number of deleted records.
+func (c *Client) PurgeSkippedJobs(ctx context.Context, before time.Time) (int64, error) {
+	return c.execAdmin(ctx, `DELETE FROM gue_skipped_jobs WHERE skipped_at < $1`, before)
+}
@@ -0,0 +1,212 @@
+package gue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	"github.com/vgarvardt/gue/v2/adapter/fake"
+	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
+)
+
+func TestGuardValidate(t *testing.T) {
+	var g *Guard
+	assert.NoError(t, g.validate())
+	assert.NoError(t, (&Guard{Name: "pending"}).validate())
+	assert.Equal(t, ErrInvalidGuard, (&Guard{}).validate())
+	assert.Equal(t, ErrInvalidGuard, (&Guard{Args: []string{"42"}}).validate())
+}
+
+func TestGuardSkipReason(t *testing.T) {
+	assert.Equal(t, "reminder completed", (&Guard{Name: "pending", Reason: "reminder completed"}).skipReason())
+	assert.Equal(t, `guard "pending" failed`, (&Guard{Name: "pending"}).skipReason())
+}
+
+func TestClientCheckGuard(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(nil, WithClientGuard("pending", func(ctx context.Context, j *Job, params json.RawMessage) (bool, error) {
+		var p struct {
+			Fail bool `json:"fail"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return false, err
+		}
+		if p.Fail {
+			return false, errors.New("reminders service is unavailable")
+		}
+		return true, nil
+	}), WithClientGuardSQL("not-completed", "SELECT NOT completed FROM reminders WHERE id = $1::text::bigint"))
+
+	tx := fake.NewTx().
+		OnQueryRow("SELECT NOT completed", []interface{}{false}, nil)
+
+	pass, err := c.checkGuard(ctx, NewTestJob(&Job{Guard: &Guard{Name: "not-completed", Args: []string{"42"}}}, tx))
+	require.NoError(t, err)
+	assert.False(t, pass)
+
+	calls := tx.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, "SAVEPOINT gue_guard", calls[0].SQL)
+	assert.Equal(t, "SELECT NOT completed FROM reminders WHERE id = $1::text::bigint", calls[1].SQL)
+	assert.Equal(t, []interface{}{"42"}, calls[1].Args)
+	assert.Equal(t, "RELEASE SAVEPOINT gue_guard", calls[2].SQL)
+
+	// no rows to check against fail the guard
+	tx = fake.NewTx().
+		OnQueryRow("SELECT NOT completed", nil, adapter.ErrNoRows)
+	pass, err = c.checkGuard(ctx, NewTestJob(&Job{Guard: &Guard{Name: "not-completed", Args: []string{"43"}}}, tx))
+	require.NoError(t, err)
+	assert.False(t, pass)
+	calls = tx.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, "RELEASE SAVEPOINT gue_guard", calls[2].SQL)
+
+	tx = fake.NewTx()
+	pass, err = c.checkGuard(ctx, NewTestJob(&Job{Guard: &Guard{Name: "pending", Params: json.RawMessage(`{}`)}}, tx))
+	require.NoError(t, err)
+	assert.True(t, pass)
+
+	tx = fake.NewTx()
+	_, err = c.checkGuard(ctx, NewTestJob(&Job{Guard: &Guard{Name: "pending", Params: json.RawMessage(`{"fail":true}`)}}, tx))
+	assert.EqualError(t, err, "could not check job guard: reminders service is unavailable")
+	calls = tx.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "ROLLBACK TO SAVEPOINT gue_guard", calls[1].SQL)
+
+	_, err = c.checkGuard(ctx, NewTestJob(&Job{Guard: &Guard{Name: "unknown"}}, fake.NewTx()))
+	assert.EqualError(t, err, `unknown job guard: "unknown"`)
+}
+
+func TestWorkerWorkOneGuard(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneGuard(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneGuard(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneGuard(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneGuard(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(
+		connPool,
+		WithClientGuard("always", func(ctx context.Context, j *Job, params json.RawMessage) (bool, error) {
+			return string(params) == "true", nil
+		}),
+		WithClientGuardSQL("positive", "SELECT $1::text::int > 0"),
+		WithClientGuardSQL("none", "SELECT true WHERE false"),
+		WithClientGuardSQL("division-by-zero", "SELECT 1/0 > 0"),
+	)
+	ctx := context.Background()
+
+	var worked []string
+	wm := WorkMap{
+		"SendReminder": func(j *Job) error {
+			worked = append(worked, string(j.Args))
+			return nil
+		},
+	}
+	w := NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+
+	jobs := []*Job{
+		{Type: "SendReminder", Args: []byte(`"sql-pass"`), Guard: &Guard{Name: "positive", Args: []string{"1"}}},
+		{Type: "SendReminder", Args: []byte(`"sql-fail"`), Guard: &Guard{Name: "positive", Args: []string{"0"}}},
+		{Type: "SendReminder", Args: []byte(`"named-pass"`), Guard: &Guard{Name: "always", Params: json.RawMessage(`true`)}},
+		{Type: "SendReminder", Args: []byte(`"named-fail"`), Guard: &Guard{Name: "always", Params: json.RawMessage(`false`)}},
+		{Type: "SendReminder", Args: []byte(`"sql-no-rows"`), Guard: &Guard{Name: "none", Reason: "reminder deleted"}},
+	}
+	var err error
+	for _, j := range jobs {
+		require.NoError(t, c.Enqueue(ctx, j))
+	}
+
+	err = c.Enqueue(ctx, &Job{Type: "SendReminder", Guard: &Guard{}})
+	assert.Equal(t, ErrInvalidGuard, err)
+
+	for range jobs {
+		require.True(t, w.WorkOne(ctx))
+	}
+	assert.ElementsMatch(t, []string{`"sql-pass"`, `"named-pass"`}, worked)
+	assert.Nil(t, findOneJob(t, connPool))
+
+	skipped, err := c.SkippedJobs(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, skipped, 3)
+	reasons := make([]string, 0, len(skipped))
+	for _, s := range skipped {
+		assert.Equal(t, "SendReminder", s.Type)
+		reasons = append(reasons, s.Reason)
+	}
+	assert.ElementsMatch(t, []string{`guard "positive" failed`, `guard "always" failed`, "reminder deleted"}, reasons)
+
+	purged, err := c.PurgeSkippedJobs(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+
+	// failed SQL check does not abort job transaction and the job is retried
+	require.NoError(t, c.Enqueue(ctx, &Job{Type: "SendReminder", Guard: &Guard{Name: "division-by-zero"}}))
+	require.True(t, w.WorkOne(ctx))
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+	assert.Equal(t, int32(1), j.ErrorCount)
+	assert.Contains(t, j.LastError.String, "could not check job guard")
+}
+
+func TestWorkerWorkOneGuardChild(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneGuardChild(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneGuardChild(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneGuardChild(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneGuardChild(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool, WithClientGuardSQL("never", "SELECT false"))
+	ctx := context.Background()
+
+	var outcomes []ChildOutcome
+	wm := WorkMap{
+		"Parent": func(j *Job) error {
+			var err error
+			if outcomes, err = j.ChildOutcomes(ctx); err != nil || len(outcomes) > 0 {
+				return err
+			}
+
+			if err := j.SpawnChild(ctx, &Job{Type: "Child", Guard: &Guard{Name: "never", Reason: "not needed"}}); err != nil {
+				return err
+			}
+			return ErrAwaitChildren
+		},
+		"Child": func(j *Job) error {
+			return nil
+		},
+	}
+	w := NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+
+	require.NoError(t, c.Enqueue(ctx, &Job{Type: "Parent"}))
+
+	// parent spawns child, child is skipped and parent is resumed
+	for i := 0; i < 3; i++ {
+		require.True(t, w.WorkOne(ctx))
+	}
+	require.Len(t, outcomes, 1)
+	assert.True(t, outcomes[0].Skipped)
+	assert.True(t, outcomes[0].Succeeded)
+	assert.Equal(t, "not needed", outcomes[0].SkipReason)
+	assert.Empty(t, outcomes[0].Error)
+
+	assert.False(t, w.WorkOne(ctx))
+}
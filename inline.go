@@ -0,0 +1,109 @@
+package gue
+
+import (
+	"context"
+	"time"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+// InlineMode defines how jobs are executed by the client in inline mode.
+type InlineMode int
+
+const (
+	// InlineSync runs job handler synchronously, Enqueue returns after the handler is finished.
+	InlineSync InlineMode = iota + 1
+	// InlineAsync runs job handler in a goroutine, Enqueue returns right after the job is enqueued.
+	InlineAsync
+)
+
+func (m InlineMode) valid() bool {
+	return m == InlineSync || m == InlineAsync
+}
+
+// inlineRunner works jobs right after they are enqueued by the client. Jobs are stored
+// in the DB as usual and then locked and worked by their IDs using regular Worker
+// flow, so error handling and retries behave exactly as with Worker.
+type inlineRunner struct {
+	c      *Client
+	w      *Worker
+	mode   InlineMode
+	timer  bool
+	logger adapter.Logger
+}
+
+func newInlineRunner(c *Client, wm WorkMap, mode InlineMode, timer bool) *inlineRunner {
+	return &inlineRunner{
+		c:      c,
+		w:      NewWorker(c, wm, WithWorkerID(c.id+"/inline"), WithWorkerLogger(c.logger)),
+		mode:   mode,
+		timer:  timer,
+		logger: c.logger,
+	}
+}
+
+// enqueued is called for the job enqueued outside of a transaction
+// or within already committed transaction.
+func (r *inlineRunner) enqueued(ctx context.Context, j *Job) {
+	if _, _, ok := r.w.workFunc(j.Type); !ok {
+		// leave the job for regular workers
+		return
+	}
+
+	if r.mode == InlineSync && !j.RunAt.After(time.Now()) {
+		r.work(ctx, j.ID)
+		return
+	}
+
+	r.schedule(j.ID, j.RunAt)
+}
+
+// schedule works the job in a goroutine, at its RunAt time if timer is enabled.
+// Jobs scheduled in the future are left to regular workers if timer is disabled.
+func (r *inlineRunner) schedule(id int64, runAt time.Time) {
+	delay := time.Until(runAt)
+	if delay <= 0 {
+		go r.work(context.Background(), id)
+		return
+	}
+
+	if r.timer {
+		time.AfterFunc(delay, func() {
+			r.work(context.Background(), id)
+		})
+	}
+}
+
+func (r *inlineRunner) work(ctx context.Context, id int64) {
+	j, err := r.c.LockJobByID(ctx, id)
+	if err != nil {
+		r.logger.Error("Failed to lock inline job", adapter.Err(err), adapter.F("job-id", id))
+		return
+	}
+	if j == nil {
+		// job was already worked or locked by someone else
+		return
+	}
+
+	errorCount := j.ErrorCount
+	r.w.workJob(ctx, j)
+
+	if j.ErrorCount > errorCount {
+		// job failed and was rescheduled, retry it at the new time
+		r.schedule(id, j.RunAt)
+	}
+}
+
+// InlineAfterCommit works jobs enqueued with EnqueueTx in inline mode, it must be called
+// after the transaction is committed. Jobs enqueued within a transaction can not be worked
+// before the commit, so they are not worked inline unless passed here. Does nothing if
+// inline mode is not enabled for the client.
+func (c *Client) InlineAfterCommit(ctx context.Context, jobs ...*Job) {
+	if c.inline == nil {
+		return
+	}
+
+	for _, j := range jobs {
+		c.inline.enqueued(ctx, j)
+	}
+}
@@ -0,0 +1,123 @@
+package gue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
+)
+
+func TestInlineSync(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testInlineSync(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testInlineSync(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testInlineSync(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testInlineSync(t *testing.T, connPool adapter.ConnPool) {
+	var worked int32
+	wm := WorkMap{
+		"MyJob": func(j *Job) error {
+			atomic.AddInt32(&worked, 1)
+			return nil
+		},
+		"Failing": func(j *Job) error {
+			return errors.New("the error msg")
+		},
+	}
+
+	c := NewClient(connPool, WithClientInline(wm, InlineSync))
+	ctx := context.Background()
+
+	err := c.Enqueue(ctx, &Job{Type: "MyJob"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&worked))
+	assert.Nil(t, findOneJob(t, connPool))
+
+	// future jobs are left to workers without timer
+	err = c.Enqueue(ctx, &Job{Type: "MyJob", RunAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&worked))
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+	_, err = connPool.Exec(ctx, `DELETE FROM gue_jobs`)
+	require.NoError(t, err)
+
+	// failed jobs go through regular error path
+	err = c.Enqueue(ctx, &Job{Type: "Failing"})
+	require.NoError(t, err)
+
+	j = findOneJob(t, connPool)
+	require.NotNil(t, j)
+	assert.Equal(t, int32(1), j.ErrorCount)
+	assert.Equal(t, "the error msg", j.LastError.String)
+}
+
+func TestInlineAsyncTx(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testInlineAsyncTx(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testInlineAsyncTx(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testInlineAsyncTx(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testInlineAsyncTx(t *testing.T, connPool adapter.ConnPool) {
+	worked := make(chan int64, 1)
+	wm := WorkMap{
+		"MyJob": func(j *Job) error {
+			worked <- j.ID
+			return nil
+		},
+	}
+
+	c := NewClient(connPool, WithClientInline(wm, InlineAsync), WithClientInlineTimer())
+	ctx := context.Background()
+
+	tx, err := connPool.Begin(ctx)
+	require.NoError(t, err)
+
+	j := &Job{Type: "MyJob", RunAt: time.Now().Add(200 * time.Millisecond)}
+	err = c.EnqueueTx(ctx, j, tx)
+	require.NoError(t, err)
+
+	select {
+	case <-worked:
+		t.Fatal("job must not be worked before commit")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	err = tx.Commit(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-worked:
+		t.Fatal("job must not be worked until passed to InlineAfterCommit")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	c.InlineAfterCommit(ctx, j)
+
+	select {
+	case id := <-worked:
+		assert.Equal(t, j.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not worked after commit")
+	}
+}
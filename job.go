@@ -2,6 +2,8 @@ package gue
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -47,11 +49,92 @@ type Job struct {
 	// failed. It is ignored on job creation.
 	LastError pgtype.Text
 
+	// LastFailedHost is the host of the worker that failed the job last time.
+	// It is ignored on job creation.
+	LastFailedHost pgtype.Text
+
+	// LastFailedWorker is the ID of the worker that failed the job last time.
+	// It is ignored on job creation.
+	LastFailedWorker pgtype.Text
+
+	// Failures is the history of the last failed attempts to work the job, oldest first.
+	// The number of kept attempts is set with WithClientFailureHistory.
+	// It is ignored on job creation.
+	Failures []JobFailure
+
+	// ParentID is the ID of the parent job for jobs spawned with Job.SpawnChild,
+	// zero for other jobs.
+	ParentID int64
+
+	// QuotaKey is the optional key, e.g. tenant or user ID, the number of pending jobs
+	// is limited by in queues with quota policy configured with WithClientQueueQuota.
+	QuotaKey string
+
+	// Guard is the optional execution guard checked before the job is worked,
+	// the job is skipped if the guard fails.
+	Guard *Guard
+
+	// Result is the optional result of the successfully worked job, set by WorkFunc.
+	// Result must be the bytes of a valid JSON string. It is ignored on job creation.
+	Result []byte
+
+	// RetrySchedule is the optional job-specific retry schedule. When set, it is
+	// used instead of the client-wide Backoff to reschedule failed job.
+	RetrySchedule *RetrySchedule
+
 	mu      sync.Mutex
 	deleted bool
 	pool    adapter.ConnPool
 	tx      adapter.Tx
 	backoff Backoff
+	release func()
+
+	client   *Client
+	spoolKey string
+	host     string
+	workerID string
+
+	hasChildOutcomes bool
+	secrets          []string
+}
+
+// defaultFailureHistory is the number of the last failed attempts kept in the job history,
+// see WithClientFailureHistory.
+const defaultFailureHistory = 10
+
+// JobFailure is a single failed attempt to work the job.
+type JobFailure struct {
+	// Attempt is the number of the failed attempt, starting from 1.
+	Attempt int32 `json:"attempt"`
+	// Host is the host of the worker that failed the job.
+	Host string `json:"host,omitempty"`
+	// Worker is the ID of the worker that failed the job.
+	Worker string `json:"worker,omitempty"`
+	// Error is the error message the job failed with.
+	Error string `json:"error"`
+	// FailedAt is the time the job failed at.
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// failureHistory returns the number of the last failed attempts kept in the job history.
+func (j *Job) failureHistory() int {
+	if j.client == nil {
+		return defaultFailureHistory
+	}
+	return j.client.failureHistory
+}
+
+func unmarshalJobFailures(data []byte) ([]JobFailure, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var failures []JobFailure
+	if err := json.Unmarshal(data, &failures); err != nil {
+		return nil, err
+	}
+
+	return failures, nil
 }
 
 // Tx returns DB transaction that this job is locked to. You may use
@@ -65,11 +148,73 @@ func (j *Job) Tx() adapter.Tx {
 	return j.tx
 }
 
+// errInvalidResult is the error the job is failed with when its Result is not a valid JSON.
+var errInvalidResult = errors.New("job result is not a valid JSON")
+
+// validateResult returns errInvalidResult if the job Result is set, but is not a valid JSON.
+func (j *Job) validateResult() error {
+	if len(j.Result) > 0 && !json.Valid(j.Result) {
+		return errInvalidResult
+	}
+	return nil
+}
+
+// inSavepoint runs fn in the savepoint of the job transaction, so that failed fn does not
+// abort the transaction and the job can still be updated, e.g. failed with Error.
+func (j *Job) inSavepoint(ctx context.Context, name string, fn func() error) error {
+	tx := j.Tx()
+	if _, err := tx.Exec(ctx, `SAVEPOINT `+name); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec(ctx, `ROLLBACK TO SAVEPOINT `+name); rbErr != nil {
+			return fmt.Errorf("rollback to savepoint failed (%v): %w", rbErr, err)
+		}
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `RELEASE SAVEPOINT `+name)
+	return err
+}
+
 // Delete marks this job as complete by deleting it form the database.
+// Child job with Result that is not a valid JSON is not deleted and an error is
+// returned, as the result can not be recorded for the parent, fail the job with Error.
 //
 // You must also later call Done() to return this job's database connection to
 // the pool.
 func (j *Job) Delete(ctx context.Context) error {
+	if j.ParentID != 0 {
+		// checked before touching the transaction, so that the job can still be failed
+		if err := j.validateResult(); err != nil {
+			return err
+		}
+	}
+	return j.delete(ctx, childSucceeded, "")
+}
+
+// skip deletes the job that should not be worked because its guard failed,
+// the skip is recorded to gue_skipped_jobs, see Client.SkippedJobs.
+func (j *Job) skip(ctx context.Context, reason string) error {
+	j.mu.Lock()
+	_, err := j.tx.Exec(ctx, `INSERT INTO gue_skipped_jobs (job_id, queue, job_type, reason, skipped_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (job_id) DO NOTHING`, j.ID, j.Queue, j.Type, reason, time.Now())
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return j.delete(ctx, childSkipped, reason)
+}
+
+// giveUp deletes failed job that should not be retried anymore.
+func (j *Job) giveUp(ctx context.Context, msg string) error {
+	return j.delete(ctx, childFailed, msg)
+}
+
+func (j *Job) delete(ctx context.Context, status childStatus, msg string) error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
@@ -82,6 +227,16 @@ func (j *Job) Delete(ctx context.Context) error {
 		return err
 	}
 
+	if j.hasChildOutcomes {
+		if _, err := j.tx.Exec(ctx, `DELETE FROM gue_child_outcomes WHERE parent_id = $1`, j.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := finishChild(ctx, j.tx, j, status, msg); err != nil {
+		return err
+	}
+
 	j.deleted = true
 	return nil
 }
@@ -91,11 +246,16 @@ func (j *Job) Done(ctx context.Context) error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
-	if j.tx == nil || j.pool == nil {
+	if j.tx == nil {
 		// already marked as done
 		return nil
 	}
 
+	if j.release != nil {
+		// connection is returned to the pool on commit regardless of its result
+		defer j.release()
+	}
+
 	if err := j.tx.Commit(ctx); err != nil {
 		return err
 	}
@@ -110,6 +270,11 @@ func (j *Job) Done(ctx context.Context) error {
 // message or backtrace can be provided as msg, which will be saved on the job.
 // It will also increase the error count.
 //
+// If the job has RetrySchedule and it has no more retries left, the job is given up
+// and deleted instead of being rescheduled. Otherwise ErrorCount, RunAt and LastError
+// of the job are updated to the rescheduled values. Secret values resolved for the job
+// are redacted from msg.
+//
 // This call marks job as done and releases (commits) transaction,
 //so calling Done() is not required, although calling it will not cause any issues.
 func (j *Job) Error(ctx context.Context, msg string) (err error) {
@@ -120,16 +285,68 @@ func (j *Job) Error(ctx context.Context, msg string) (err error) {
 		}
 	}()
 
+	msg = j.redact(msg)
 	errorCount := j.ErrorCount + 1
 
-	newRunAt := time.Now().Add(j.backoff(int(errorCount)))
+	delay := j.backoff(int(errorCount))
+	if j.RetrySchedule != nil {
+		var retry bool
+		if delay, retry = j.RetrySchedule.Delay(int(errorCount)); !retry {
+			return j.giveUp(ctx, msg)
+		}
+	} else if j.ParentID != 0 && errorCount >= j.childMaxAttempts() {
+		// parent waits for the child to finish, so the child can not be retried forever
+		return j.giveUp(ctx, msg)
+	}
+
+	now := time.Now()
+	newRunAt := now.Add(delay)
+
+	lastFailedHost := textOrNull(j.host)
+	lastFailedWorker := textOrNull(j.workerID)
+
+	// job is locked, so the loaded history is up to date
+	failures := append(j.Failures[:len(j.Failures):len(j.Failures)], JobFailure{
+		Attempt:  errorCount,
+		Host:     j.host,
+		Worker:   j.workerID,
+		Error:    msg,
+		FailedAt: now,
+	})
+	if limit := j.failureHistory(); len(failures) > limit {
+		failures = failures[len(failures)-limit:]
+	}
+	failuresData, err := json.Marshal(failures)
+	if err != nil {
+		return fmt.Errorf("could not marshal job failures: %w", err)
+	}
 
 	_, err = j.tx.Exec(ctx, `UPDATE gue_jobs
-SET error_count = $1,
-    run_at      = $2,
-    last_error  = $3,
-	updated_at  = $4
-WHERE job_id    = $5`, errorCount, newRunAt, msg, time.Now(), j.ID)
+SET error_count        = $1,
+    run_at             = $2,
+    last_error         = $3,
+    last_failed_host   = $4,
+    last_failed_worker = $5,
+    failures           = $6::text::json,
+    updated_at         = $7
+WHERE job_id           = $8`, errorCount, newRunAt, msg, lastFailedHost.Get(), lastFailedWorker.Get(), string(failuresData), now, j.ID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	j.ErrorCount = errorCount
+	j.RunAt = newRunAt
+	j.LastError = pgtype.Text{String: msg, Status: pgtype.Present}
+	j.LastFailedHost = lastFailedHost
+	j.LastFailedWorker = lastFailedWorker
+	j.Failures = failures
+
+	return nil
+}
+
+func textOrNull(s string) pgtype.Text {
+	if s == "" {
+		return pgtype.Text{Status: pgtype.Null}
+	}
+	return pgtype.Text{String: s, Status: pgtype.Present}
 }
@@ -0,0 +1,127 @@
+package gue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	"github.com/vgarvardt/gue/v2/adapter/fake"
+)
+
+func TestNewTestJob(t *testing.T) {
+	ctx := context.Background()
+	tx := fake.NewTx().
+		OnQueryRow("SELECT balance", []interface{}{int64(42)}, nil).
+		OnExec("UPDATE accounts", 1, nil)
+
+	wf := func(j *Job) error {
+		var balance int64
+		if err := j.Tx().QueryRow(ctx, `SELECT balance FROM accounts WHERE id = $1`, 1).Scan(&balance); err != nil {
+			return err
+		}
+
+		ct, err := j.Tx().Exec(ctx, `UPDATE accounts SET balance = $1 WHERE id = $2`, balance+1, 1)
+		if err != nil {
+			return err
+		}
+		if ct.RowsAffected() != 1 {
+			return errors.New("account not found")
+		}
+		return nil
+	}
+
+	j := NewTestJob(&Job{ID: 123, Type: "MyJob"}, tx)
+	require.NoError(t, wf(j))
+	require.NoError(t, j.Delete(ctx))
+	require.NoError(t, j.Done(ctx))
+
+	assert.True(t, tx.Committed())
+	assert.False(t, tx.RolledBack())
+	assert.Nil(t, j.Tx())
+
+	calls := tx.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, []interface{}{1}, calls[0].Args)
+	assert.Equal(t, []interface{}{int64(43), 1}, calls[1].Args)
+	assert.Contains(t, calls[2].SQL, "DELETE FROM gue_jobs")
+	assert.Equal(t, []interface{}{int64(123)}, calls[2].Args)
+}
+
+func TestNewTestJobErrorChildMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	tx := fake.NewTx()
+
+	j := NewTestJob(&Job{ID: 123, Type: "MyJob", ParentID: 1, ErrorCount: defaultChildMaxAttempts - 1}, tx)
+	require.NoError(t, j.Error(ctx, "the error msg"))
+
+	assert.True(t, tx.Committed())
+	calls := tx.Calls()
+	require.NotEmpty(t, calls)
+	assert.Contains(t, calls[0].SQL, "DELETE FROM gue_jobs")
+}
+
+func TestNewTestJobError(t *testing.T) {
+	ctx := context.Background()
+	tx := fake.NewTx()
+
+	customBackoff := func(retries int) time.Duration {
+		return time.Duration(retries) * time.Hour
+	}
+
+	j := NewTestJob(&Job{ID: 123, Type: "MyJob"}, tx, WithTestJobBackoff(customBackoff))
+	require.NoError(t, j.Error(ctx, "the error msg"))
+
+	assert.True(t, tx.Committed())
+	assert.Equal(t, int32(1), j.ErrorCount)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), j.RunAt, time.Minute)
+	require.Len(t, j.Failures, 1)
+	assert.Equal(t, int32(1), j.Failures[0].Attempt)
+	assert.Equal(t, "the error msg", j.Failures[0].Error)
+
+	_, err := tx.Exec(ctx, `SELECT 1`)
+	assert.Equal(t, adapter.ErrTxClosed, err)
+}
+
+func TestNewTestJobErrorFailureHistory(t *testing.T) {
+	ctx := context.Background()
+
+	failures := make([]JobFailure, defaultFailureHistory)
+	for i := range failures {
+		failures[i] = JobFailure{Attempt: int32(i + 1), Error: "old error"}
+	}
+
+	j := NewTestJob(&Job{ID: 123, Type: "MyJob", ErrorCount: defaultFailureHistory, Failures: failures}, fake.NewTx())
+	require.NoError(t, j.Error(ctx, "the error msg"))
+
+	// the oldest attempt is dropped from the history
+	require.Len(t, j.Failures, defaultFailureHistory)
+	assert.Equal(t, int32(2), j.Failures[0].Attempt)
+	assert.Equal(t, int32(defaultFailureHistory+1), j.Failures[defaultFailureHistory-1].Attempt)
+	assert.Equal(t, "the error msg", j.Failures[defaultFailureHistory-1].Error)
+}
+
+func TestJobValidateResult(t *testing.T) {
+	assert.NoError(t, (&Job{}).validateResult())
+	assert.NoError(t, (&Job{Result: []byte(`{"ok":true}`)}).validateResult())
+	assert.Equal(t, errInvalidResult, (&Job{Result: []byte("done")}).validateResult())
+}
+
+func TestNewTestJobDeleteChildInvalidResult(t *testing.T) {
+	ctx := context.Background()
+	tx := fake.NewTx()
+
+	j := NewTestJob(&Job{ID: 123, Type: "MyJob", ParentID: 1}, tx)
+	j.Result = []byte("done")
+
+	// invalid result can not be recorded for the parent, so the child is not deleted
+	assert.Equal(t, errInvalidResult, j.Delete(ctx))
+	assert.Empty(t, tx.Calls())
+
+	require.NoError(t, j.Error(ctx, errInvalidResult.Error()))
+	assert.True(t, tx.Committed())
+}
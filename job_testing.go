@@ -0,0 +1,37 @@
+package gue
+
+import (
+	"github.com/vgarvardt/gue/v2/adapter"
+	"github.com/vgarvardt/gue/v2/adapter/exponential"
+)
+
+// TestJobOption defines a type that allows to set test job properties during the build-time.
+type TestJobOption func(*Job)
+
+// WithTestJobPool sets connection pool the test job belongs to.
+func WithTestJobPool(pool adapter.ConnPool) TestJobOption {
+	return func(j *Job) {
+		j.pool = pool
+	}
+}
+
+// WithTestJobBackoff sets backoff implementation that will be applied to the test job on error.
+func WithTestJobBackoff(backoff Backoff) TestJobOption {
+	return func(j *Job) {
+		j.backoff = backoff
+	}
+}
+
+// NewTestJob builds a Job locked to the given transaction, as if it was returned by
+// Client.LockJob. It allows to unit-test WorkFunc that uses Job.Tx() without
+// a database, e.g. with adapter/fake.Tx. Exported fields of j are kept as is.
+func NewTestJob(j *Job, tx adapter.Tx, options ...TestJobOption) *Job {
+	j.tx = tx
+	j.backoff = exponential.Default
+
+	for _, option := range options {
+		option(j)
+	}
+
+	return j
+}
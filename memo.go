@@ -0,0 +1,77 @@
+package gue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+// memoKeySQL is the memoized result key expression - hash of the job type and args,
+// args are normalised with jsonb, so that formatting and keys order do not matter.
+const memoKeySQL = `md5($1::text || ':' || $2::text::jsonb::text)`
+
+// memoized looks up the cached result of the identical job and sets it to the job.
+// Returns true if the cached result was found. Lookup runs in the savepoint, so that
+// failed lookup does not abort the job transaction.
+func (c *Client) memoized(ctx context.Context, j *Job, jobType string) (bool, error) {
+	if _, ok := c.memoTTL[jobType]; !ok {
+		return false, nil
+	}
+
+	var (
+		result []byte
+		found  bool
+	)
+	err := j.inSavepoint(ctx, "gue_memo", func() error {
+		err := j.Tx().QueryRow(ctx, `SELECT result FROM gue_memoized_results
+WHERE memo_key = `+memoKeySQL+` AND expires_at > $3`, jobType, string(j.Args), time.Now()).Scan(&result)
+		if err == adapter.ErrNoRows {
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not look up memoized job result: %w", err)
+	}
+	if !found {
+		return false, nil
+	}
+
+	j.Result = result
+	return true, nil
+}
+
+// memoize caches the result of the successfully worked job. Result is cached in the savepoint,
+// so that failed caching does not abort the job transaction.
+func (c *Client) memoize(ctx context.Context, j *Job, jobType string) error {
+	ttl, ok := c.memoTTL[jobType]
+	if !ok {
+		return nil
+	}
+
+	var result interface{}
+	if len(j.Result) > 0 {
+		result = j.Result
+	}
+
+	err := j.inSavepoint(ctx, "gue_memo", func() error {
+		_, err := j.Tx().Exec(ctx, `INSERT INTO gue_memoized_results (memo_key, job_type, result, expires_at)
+VALUES (`+memoKeySQL+`, $1, $3, $4)
+ON CONFLICT (memo_key) DO UPDATE SET result = excluded.result, expires_at = excluded.expires_at`,
+			jobType, string(j.Args), result, time.Now().Add(ttl))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not memoize job result: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeMemoizedResults deletes expired memoized job results and returns the number of deleted results.
+func (c *Client) PurgeMemoizedResults(ctx context.Context) (int64, error) {
+	return c.execAdmin(ctx, `DELETE FROM gue_memoized_results WHERE expires_at <= $1`, time.Now())
+}
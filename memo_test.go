@@ -0,0 +1,63 @@
+package gue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	"github.com/vgarvardt/gue/v2/adapter/fake"
+)
+
+func TestClientMemoized(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(nil, WithClientMemoize("Report", time.Hour))
+
+	tx := fake.NewTx().
+		OnQueryRow("FROM gue_memoized_results", []interface{}{[]byte(`{"ok":true}`)}, nil)
+	j := NewTestJob(&Job{Type: "Report", Args: []byte(`{}`)}, tx)
+	memoized, err := c.memoized(ctx, j, "Report")
+	require.NoError(t, err)
+	assert.True(t, memoized)
+	assert.Equal(t, []byte(`{"ok":true}`), j.Result)
+
+	tx = fake.NewTx().
+		OnQueryRow("FROM gue_memoized_results", nil, adapter.ErrNoRows)
+	memoized, err = c.memoized(ctx, NewTestJob(&Job{Type: "Report", Args: []byte(`{}`)}, tx), "Report")
+	require.NoError(t, err)
+	assert.False(t, memoized)
+
+	// failed lookup is rolled back to the savepoint, so the job transaction is usable
+	tx = fake.NewTx().
+		OnQueryRow("FROM gue_memoized_results", nil, errors.New("relation does not exist"))
+	_, err = c.memoized(ctx, NewTestJob(&Job{Type: "Report", Args: []byte(`{}`)}, tx), "Report")
+	assert.EqualError(t, err, "could not look up memoized job result: relation does not exist")
+
+	calls := tx.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, "SAVEPOINT gue_memo", calls[0].SQL)
+	assert.Equal(t, "ROLLBACK TO SAVEPOINT gue_memo", calls[2].SQL)
+}
+
+func TestClientMemoize(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(nil, WithClientMemoize("Report", time.Hour))
+
+	tx := fake.NewTx().
+		OnExec("INSERT INTO gue_memoized_results", 0, errors.New("invalid input syntax for type json"))
+	err := c.memoize(ctx, NewTestJob(&Job{Type: "Report", Args: []byte(`{}`), Result: []byte(`{}`)}, tx), "Report")
+	assert.EqualError(t, err, "could not memoize job result: invalid input syntax for type json")
+
+	calls := tx.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, "ROLLBACK TO SAVEPOINT gue_memo", calls[2].SQL)
+
+	// job types without memoization do not touch the transaction
+	tx = fake.NewTx()
+	require.NoError(t, c.memoize(ctx, NewTestJob(&Job{Type: "Other"}, tx), "Other"))
+	assert.Empty(t, tx.Calls())
+}
@@ -0,0 +1,98 @@
+package gue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// QueueSeparator separates levels of hierarchical queue names, e.g. "emails.transactional".
+	QueueSeparator = "."
+	// QueueWildcard matches all the queues below the level it is used at, e.g. "emails.*"
+	// matches "emails.transactional" and "emails.marketing.weekly", but not "emails".
+	// Single wildcard matches all the queues.
+	QueueWildcard = "*"
+)
+
+// IsQueuePattern returns true if the queue name is the wildcard pattern.
+func IsQueuePattern(queue string) bool {
+	return queue == QueueWildcard || strings.HasSuffix(queue, QueueSeparator+QueueWildcard)
+}
+
+// MatchQueue returns true if the queue matches the queue name or pattern.
+func MatchQueue(pattern, queue string) bool {
+	if !IsQueuePattern(pattern) {
+		return pattern == queue
+	}
+	if pattern == QueueWildcard {
+		return true
+	}
+
+	return strings.HasPrefix(queue, strings.TrimSuffix(pattern, QueueWildcard))
+}
+
+// queueCondition returns SQL condition selecting jobs from the queue name or pattern.
+// Patterns are matched by prefix using pattern operators, so that the condition can use
+// text_pattern_ops index.
+func queueCondition(pattern string, argOffset int) (string, []interface{}) {
+	if !IsQueuePattern(pattern) {
+		return fmt.Sprintf("queue = $%d", argOffset+1), []interface{}{pattern}
+	}
+	if pattern == QueueWildcard {
+		return "TRUE", nil
+	}
+
+	// prefix ends with the separator, so the upper bound is the prefix with
+	// the separator replaced by the next byte
+	prefix := strings.TrimSuffix(pattern, QueueWildcard)
+	upper := prefix[:len(prefix)-1] + string(QueueSeparator[0]+1)
+
+	return fmt.Sprintf("queue ~>=~ $%d AND queue ~<~ $%d", argOffset+1, argOffset+2), []interface{}{prefix, upper}
+}
+
+// QueueStats is the number of jobs in the queue or the queues hierarchy level.
+type QueueStats struct {
+	// Queue is the queue name or hierarchy level name.
+	Queue string `json:"queue"`
+	// Jobs is the total number of jobs.
+	Jobs int64 `json:"jobs"`
+	// Ready is the number of jobs ready to be worked.
+	Ready int64 `json:"ready"`
+	// Errored is the number of jobs that failed at least once.
+	Errored int64 `json:"errored"`
+}
+
+// QueueStats returns jobs statistics by queue rolled up to the given hierarchy depth,
+// e.g. with depth 1 "emails.transactional" and "emails.marketing" are counted as "emails".
+// Zero depth returns statistics by full queue names.
+func (c *Client) QueueStats(ctx context.Context, depth int) ([]QueueStats, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var data []byte
+	err = c.pool.QueryRow(ctx, `SELECT coalesce(json_agg(t ORDER BY t.queue), '[]')::text
+FROM (
+  SELECT CASE WHEN $1::int > 0 THEN array_to_string((string_to_array(queue, $3))[1:$1::int], $3) ELSE queue END AS queue,
+         count(*) AS jobs,
+         count(*) FILTER (WHERE run_at <= $2) AS ready,
+         count(*) FILTER (WHERE error_count > 0) AS errored
+  FROM gue_jobs
+  GROUP BY 1
+) t`, depth, time.Now(), QueueSeparator).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []QueueStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("could not unmarshal queue stats: %w", err)
+	}
+
+	return stats, nil
+}
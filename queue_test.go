@@ -0,0 +1,86 @@
+package gue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
+)
+
+func TestMatchQueue(t *testing.T) {
+	assert.True(t, MatchQueue("emails", "emails"))
+	assert.False(t, MatchQueue("emails", "emails.marketing"))
+	assert.True(t, MatchQueue("emails.*", "emails.marketing"))
+	assert.True(t, MatchQueue("emails.*", "emails.marketing.weekly"))
+	assert.False(t, MatchQueue("emails.*", "emails"))
+	assert.False(t, MatchQueue("emails.*", "emailsmarketing"))
+	assert.True(t, MatchQueue("*", ""))
+	assert.True(t, MatchQueue("*", "emails.marketing"))
+}
+
+func TestQueueCondition(t *testing.T) {
+	cond, args := queueCondition("emails", 1)
+	assert.Equal(t, "queue = $2", cond)
+	assert.Equal(t, []interface{}{"emails"}, args)
+
+	cond, args = queueCondition("emails.*", 0)
+	assert.Equal(t, "queue ~>=~ $1 AND queue ~<~ $2", cond)
+	assert.Equal(t, []interface{}{"emails.", "emails/"}, args)
+
+	cond, args = queueCondition("*", 0)
+	assert.Equal(t, "TRUE", cond)
+	assert.Empty(t, args)
+}
+
+func TestLockJobQueuePattern(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testLockJobQueuePattern(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testLockJobQueuePattern(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testLockJobQueuePattern(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testLockJobQueuePattern(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool)
+	ctx := context.Background()
+
+	for _, queue := range []string{"emails", "emailsfoo", "emails.transactional", "emails.marketing.weekly"} {
+		err := c.Enqueue(ctx, &Job{Type: "MyJob", Queue: queue})
+		require.NoError(t, err)
+	}
+
+	var locked []*Job
+	for {
+		j, err := c.LockJob(ctx, "emails.*")
+		require.NoError(t, err)
+		if j == nil {
+			break
+		}
+		locked = append(locked, j)
+	}
+
+	require.Len(t, locked, 2)
+	for _, j := range locked {
+		assert.True(t, MatchQueue("emails.*", j.Queue))
+		require.NoError(t, j.Done(ctx))
+	}
+
+	stats, err := c.QueueStats(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []QueueStats{
+		{Queue: "emails", Jobs: 3, Ready: 3},
+		{Queue: "emailsfoo", Jobs: 1, Ready: 1},
+	}, stats)
+
+	stats, err = c.QueueStats(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, stats, 4)
+}
@@ -0,0 +1,129 @@
+package gue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+// QuotaAction defines what happens to the job enqueued when its quota key has reached the quota.
+type QuotaAction int
+
+const (
+	// QuotaReject rejects the job with QuotaExceededError, this is the default action.
+	QuotaReject QuotaAction = iota + 1
+	// QuotaDefer enqueues the job to be worked not earlier than after the policy delay.
+	QuotaDefer
+)
+
+// String returns human-readable quota action name
+func (a QuotaAction) String() string {
+	switch a {
+	case QuotaDefer:
+		return "defer"
+	default:
+		return "reject"
+	}
+}
+
+// QuotaPolicy limits the number of pending jobs with the same Job.QuotaKey in the queue,
+// so that a single tenant or user can not flood the queue. Jobs without QuotaKey are not limited.
+type QuotaPolicy struct {
+	// MaxPending is the maximum number of pending jobs per quota key.
+	MaxPending int64
+	// Action is the action applied to jobs enqueued over the quota, defaults to QuotaReject.
+	Action QuotaAction
+	// DeferBy is the delay jobs over the quota are scheduled with for QuotaDefer action.
+	// Deferred jobs are pending too, so they count towards the quota.
+	DeferBy time.Duration
+}
+
+// QuotaExceededError is returned on enqueueing a job when its quota key has reached the quota.
+type QuotaExceededError struct {
+	Queue      string
+	QuotaKey   string
+	MaxPending int64
+}
+
+// Error implements error interface
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for key %q in queue %q: %d pending jobs", e.QuotaKey, e.Queue, e.MaxPending)
+}
+
+// ErrQuotaFromQuery is returned on enqueueing jobs from query with the QuotaKey set
+// to the queue with quota policy configured, as the policy is applied to jobs one by one.
+var ErrQuotaFromQuery = errors.New("jobs with quota key can not be enqueued from query to the queue with quota policy")
+
+// checkQuota applies the queue quota policy to the job being enqueued. Quota key counter
+// row is locked till the end of the transaction, so concurrent enqueues with the same
+// key can not exceed the quota.
+func (c *Client) checkQuota(ctx context.Context, j *Job, q adapter.Queryable) error {
+	policy, ok := c.quotas[j.Queue]
+	if !ok || j.QuotaKey == "" {
+		return nil
+	}
+
+	var pending int64
+	err := q.QueryRow(ctx, `INSERT INTO gue_quota_counts (queue, quota_key, pending)
+VALUES ($1, $2, 0)
+ON CONFLICT (queue, quota_key) DO UPDATE SET pending = gue_quota_counts.pending
+RETURNING pending`, j.Queue, j.QuotaKey).Scan(&pending)
+	if err != nil {
+		return err
+	}
+
+	if pending < policy.MaxPending {
+		return nil
+	}
+
+	if policy.Action == QuotaDefer {
+		if runAt := time.Now().Add(policy.DeferBy); j.RunAt.Before(runAt) {
+			j.RunAt = runAt
+		}
+		return nil
+	}
+
+	return &QuotaExceededError{Queue: j.Queue, QuotaKey: j.QuotaKey, MaxPending: policy.MaxPending}
+}
+
+// enqueue inserts the job using the client pool, the job is inserted within the
+// transaction if it is subject to the queue quota.
+func (c *Client) enqueue(ctx context.Context, j *Job) error {
+	if _, ok := c.quotas[j.Queue]; !ok || j.QuotaKey == "" {
+		return c.execEnqueue(ctx, j, c.pool)
+	}
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.execEnqueue(ctx, j, tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("could not enqueue a job (rollback result: %v): %w", rbErr, err)
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// QuotaUsage returns the number of pending jobs with the quota key in the queue.
+func (c *Client) QuotaUsage(ctx context.Context, queue, quotaKey string) (int64, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	var pending int64
+	err = c.pool.QueryRow(ctx, `SELECT coalesce(
+  (SELECT pending FROM gue_quota_counts WHERE queue = $1 AND quota_key = $2),
+  0
+)`, queue, quotaKey).Scan(&pending)
+
+	return pending, err
+}
@@ -0,0 +1,101 @@
+package gue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
+)
+
+func TestQuotaExceededError(t *testing.T) {
+	var err error = &QuotaExceededError{Queue: "reports", QuotaKey: "tenant-1", MaxPending: 2}
+
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "tenant-1", quotaErr.QuotaKey)
+	assert.Equal(t, `quota exceeded for key "tenant-1" in queue "reports": 2 pending jobs`, err.Error())
+}
+
+func TestEnqueueQuota(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testEnqueueQuota(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testEnqueueQuota(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testEnqueueQuota(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testEnqueueQuota(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool,
+		WithClientQueueQuota("reports", QuotaPolicy{MaxPending: 2}),
+		WithClientQueueQuota("exports", QuotaPolicy{MaxPending: 1, Action: QuotaDefer, DeferBy: time.Hour}),
+	)
+	ctx := context.Background()
+
+	jobs := []*Job{
+		{Queue: "reports", Type: "Report", QuotaKey: "tenant-1"},
+		{Queue: "reports", Type: "Report", QuotaKey: "tenant-1"},
+	}
+	for _, j := range jobs {
+		require.NoError(t, c.Enqueue(ctx, j))
+	}
+
+	err := c.Enqueue(ctx, &Job{Queue: "reports", Type: "Report", QuotaKey: "tenant-1"})
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "reports", quotaErr.Queue)
+	assert.Equal(t, int64(2), quotaErr.MaxPending)
+
+	// other keys, jobs without key and queues without quota are not limited
+	require.NoError(t, c.Enqueue(ctx, &Job{Queue: "reports", Type: "Report", QuotaKey: "tenant-2"}))
+	require.NoError(t, c.Enqueue(ctx, &Job{Queue: "reports", Type: "Report"}))
+	require.NoError(t, c.Enqueue(ctx, &Job{Type: "Report", QuotaKey: "tenant-1"}))
+
+	pending, err := c.QuotaUsage(ctx, "reports", "tenant-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pending)
+
+	// finished job frees the quota
+	j, err := c.LockJobByID(ctx, jobs[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, j)
+	assert.Equal(t, "tenant-1", j.QuotaKey)
+	require.NoError(t, j.Delete(ctx))
+	require.NoError(t, j.Done(ctx))
+
+	pending, err = c.QuotaUsage(ctx, "reports", "tenant-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pending)
+
+	// jobs over the quota are deferred
+	first := &Job{Queue: "exports", Type: "Export", QuotaKey: "tenant-1"}
+	require.NoError(t, c.Enqueue(ctx, first))
+	second := &Job{Queue: "exports", Type: "Export", QuotaKey: "tenant-1"}
+	require.NoError(t, c.Enqueue(ctx, second))
+	assert.True(t, second.RunAt.After(first.RunAt.Add(59*time.Minute)))
+
+	pending, err = c.QuotaUsage(ctx, "exports", "tenant-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pending)
+
+	// moved jobs are counted in the new queue
+	_, err = c.MoveJobs(ctx, MustParseFilter(`queue = "exports"`), "archive")
+	require.NoError(t, err)
+
+	pending, err = c.QuotaUsage(ctx, "exports", "tenant-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), pending)
+
+	pending, err = c.QuotaUsage(ctx, "archive", "tenant-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pending)
+}
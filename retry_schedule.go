@@ -0,0 +1,101 @@
+package gue
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/vgarvardt/backoff"
+
+	"github.com/vgarvardt/gue/v2/adapter/exponential"
+)
+
+// RetrySchedule defines how a specific job is retried when it fails. It is set by the
+// producer, persisted with the job and takes precedence over the client-wide Backoff.
+//
+// When Delays are set, n-th retry is scheduled after n-th delay and the job is given up
+// (discarded) once all the delays are used. Otherwise, Backoff spec is used.
+type RetrySchedule struct {
+	// Delays is the explicit list of delays between retries.
+	Delays []time.Duration `json:"delays,omitempty"`
+	// Backoff is the exponential backoff spec used when Delays are not set.
+	Backoff *BackoffSpec `json:"backoff,omitempty"`
+}
+
+// ErrInvalidRetrySchedule is returned on enqueueing a job with a retry schedule
+// that has neither Delays nor Backoff set.
+var ErrInvalidRetrySchedule = errors.New("job retry schedule must have either delays or backoff set")
+
+func (s *RetrySchedule) validate() error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Delays) == 0 && s.Backoff == nil {
+		return ErrInvalidRetrySchedule
+	}
+	return nil
+}
+
+// BackoffSpec is the exponential backoff configuration stored with the job.
+type BackoffSpec struct {
+	// BaseDelay is the amount of time to backoff after the first failure.
+	BaseDelay time.Duration `json:"base_delay"`
+	// Multiplier is the factor with which to multiply backoffs after a failed retry.
+	Multiplier float64 `json:"multiplier"`
+	// Jitter is the factor with which backoffs are randomized.
+	Jitter float64 `json:"jitter"`
+	// MaxDelay is the upper bound of backoff delay.
+	MaxDelay time.Duration `json:"max_delay"`
+	// MaxRetries is the number of retries after which the job is given up (discarded).
+	// Zero means the job is retried forever.
+	MaxRetries int `json:"max_retries"`
+}
+
+// Delay returns the delay before the given retry (starting from 1) and whether
+// the job should be retried at all.
+func (s *RetrySchedule) Delay(retries int) (time.Duration, bool) {
+	if len(s.Delays) > 0 {
+		if retries < 1 || retries > len(s.Delays) {
+			return 0, false
+		}
+		return s.Delays[retries-1], true
+	}
+
+	if s.Backoff == nil {
+		return 0, false
+	}
+
+	if s.Backoff.MaxRetries > 0 && retries > s.Backoff.MaxRetries {
+		return 0, false
+	}
+
+	return exponential.New(backoff.Config{
+		BaseDelay:  s.Backoff.BaseDelay,
+		Multiplier: s.Backoff.Multiplier,
+		Jitter:     s.Backoff.Jitter,
+		MaxDelay:   s.Backoff.MaxDelay,
+	})(retries), true
+}
+
+// marshalRetrySchedule returns retry schedule representation to be stored in the DB,
+// nil schedule is stored as NULL.
+func marshalRetrySchedule(s *RetrySchedule) (interface{}, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(s)
+}
+
+func unmarshalRetrySchedule(data []byte) (*RetrySchedule, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	s := new(RetrySchedule)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,72 @@
+package gue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryScheduleDelay(t *testing.T) {
+	s := &RetrySchedule{Delays: []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute}}
+
+	for retries, want := range map[int]time.Duration{1: time.Minute, 2: 5 * time.Minute, 3: 30 * time.Minute} {
+		delay, retry := s.Delay(retries)
+		assert.True(t, retry)
+		assert.Equal(t, want, delay)
+	}
+
+	_, retry := s.Delay(4)
+	assert.False(t, retry)
+}
+
+func TestRetryScheduleDelayBackoff(t *testing.T) {
+	s := &RetrySchedule{Backoff: &BackoffSpec{
+		BaseDelay:  time.Second,
+		Multiplier: 2,
+		MaxDelay:   time.Minute,
+		MaxRetries: 3,
+	}}
+
+	delay, retry := s.Delay(1)
+	assert.True(t, retry)
+	assert.Equal(t, 2*time.Second, delay)
+
+	delay, retry = s.Delay(3)
+	assert.True(t, retry)
+	assert.Equal(t, 8*time.Second, delay)
+
+	_, retry = s.Delay(4)
+	assert.False(t, retry)
+
+	_, retry = new(RetrySchedule).Delay(1)
+	assert.False(t, retry)
+}
+
+func TestRetryScheduleValidate(t *testing.T) {
+	var s *RetrySchedule
+	assert.NoError(t, s.validate())
+	assert.NoError(t, (&RetrySchedule{Delays: []time.Duration{time.Minute}}).validate())
+	assert.NoError(t, (&RetrySchedule{Backoff: &BackoffSpec{BaseDelay: time.Second}}).validate())
+	assert.Equal(t, ErrInvalidRetrySchedule, (&RetrySchedule{}).validate())
+	assert.Equal(t, ErrInvalidRetrySchedule, (&RetrySchedule{Delays: []time.Duration{}}).validate())
+}
+
+func TestRetryScheduleMarshal(t *testing.T) {
+	value, err := marshalRetrySchedule(nil)
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	s, err := unmarshalRetrySchedule(nil)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	want := &RetrySchedule{Delays: []time.Duration{time.Minute}}
+	value, err = marshalRetrySchedule(want)
+	require.NoError(t, err)
+
+	s, err = unmarshalRetrySchedule(value.([]byte))
+	require.NoError(t, err)
+	assert.Equal(t, want, s)
+}
@@ -1,17 +1,129 @@
 CREATE TABLE IF NOT EXISTS gue_jobs
 (
-    job_id      bigserial   NOT NULL PRIMARY KEY,
-    priority    smallint    NOT NULL,
-    run_at      timestamptz NOT NULL,
+    job_id             bigserial   NOT NULL PRIMARY KEY,
+    priority           smallint    NOT NULL,
+    run_at             timestamptz NOT NULL,
+    job_type           text        NOT NULL,
+    args               json        NOT NULL,
+    error_count        integer     NOT NULL DEFAULT 0,
+    last_error         text,
+    queue              text        NOT NULL,
+    retry_schedule     json,
+    spool_key          text,
+    last_failed_host   text,
+    last_failed_worker text,
+    parent_id          bigint,
+    waiting_children   integer     NOT NULL DEFAULT 0,
+    quota_key          text,
+    guard              json,
+    failures           json,
+    created_at         timestamptz NOT NULL,
+    updated_at         timestamptz NOT NULL
+);
+
+-- columns added after the initial schema, so that existing tables are upgraded
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS retry_schedule json;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS spool_key text;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS last_failed_host text;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS last_failed_worker text;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS parent_id bigint;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS waiting_children integer NOT NULL DEFAULT 0;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS quota_key text;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS guard json;
+ALTER TABLE gue_jobs ADD COLUMN IF NOT EXISTS failures json;
+
+-- text_pattern_ops index serves both exact and prefix queue lookups, so it replaces the plain selector index
+CREATE INDEX IF NOT EXISTS "idx_gue_jobs_queue_prefix" ON "gue_jobs" ("queue" text_pattern_ops, "run_at", "priority");
+DROP INDEX IF EXISTS "idx_gue_jobs_selector";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_gue_jobs_spool_key" ON "gue_jobs" ("spool_key") WHERE spool_key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS "idx_gue_jobs_parent_id" ON "gue_jobs" ("parent_id") WHERE parent_id IS NOT NULL;
+
+COMMENT ON TABLE gue_jobs IS '2';
+
+CREATE TABLE IF NOT EXISTS gue_spool_keys
+(
+    spool_key  text        NOT NULL PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "idx_gue_spool_keys_expires_at" ON "gue_spool_keys" ("expires_at");
+
+CREATE TABLE IF NOT EXISTS gue_shed_stats
+(
+    queue      text        NOT NULL,
+    action     text        NOT NULL,
+    shed       bigint      NOT NULL,
+    updated_at timestamptz NOT NULL,
+    PRIMARY KEY (queue, action)
+);
+
+CREATE TABLE IF NOT EXISTS gue_memoized_results
+(
+    memo_key   text        NOT NULL PRIMARY KEY,
+    job_type   text        NOT NULL,
+    result     json,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS gue_child_outcomes
+(
+    parent_id   bigint      NOT NULL,
+    child_id    bigint      NOT NULL,
     job_type    text        NOT NULL,
-    args        json        NOT NULL,
-    error_count integer     NOT NULL DEFAULT 0,
-    last_error  text,
-    queue       text        NOT NULL,
-    created_at  timestamptz NOT NULL,
-    updated_at  timestamptz NOT NULL
+    succeeded   boolean     NOT NULL,
+    result      json,
+    error       text,
+    skip_reason text,
+    finished_at timestamptz NOT NULL,
+    PRIMARY KEY (parent_id, child_id)
 );
 
-CREATE INDEX IF NOT EXISTS "idx_gue_jobs_selector" ON "gue_jobs" ("queue", "run_at", "priority");
+ALTER TABLE gue_child_outcomes ADD COLUMN IF NOT EXISTS skip_reason text;
+
+CREATE TABLE IF NOT EXISTS gue_skipped_jobs
+(
+    job_id     bigint      NOT NULL PRIMARY KEY,
+    queue      text        NOT NULL,
+    job_type   text        NOT NULL,
+    reason     text        NOT NULL,
+    skipped_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "idx_gue_skipped_jobs_queue" ON "gue_skipped_jobs" ("queue", "skipped_at");
+
+CREATE TABLE IF NOT EXISTS gue_quota_counts
+(
+    queue     text   NOT NULL,
+    quota_key text   NOT NULL,
+    pending   bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (queue, quota_key)
+);
+
+CREATE OR REPLACE FUNCTION gue_quota_count() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.queue = NEW.queue AND OLD.quota_key IS NOT DISTINCT FROM NEW.quota_key THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.quota_key IS NOT NULL THEN
+        UPDATE gue_quota_counts SET pending = pending - 1 WHERE queue = OLD.queue AND quota_key = OLD.quota_key;
+        DELETE FROM gue_quota_counts WHERE queue = OLD.queue AND quota_key = OLD.quota_key AND pending <= 0;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.quota_key IS NOT NULL THEN
+        INSERT INTO gue_quota_counts (queue, quota_key, pending)
+        VALUES (NEW.queue, NEW.quota_key, 1)
+        ON CONFLICT (queue, quota_key) DO UPDATE SET pending = gue_quota_counts.pending + 1;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
 
-COMMENT ON TABLE gue_jobs IS '1';
+DROP TRIGGER IF EXISTS gue_jobs_quota_count ON gue_jobs;
+CREATE TRIGGER gue_jobs_quota_count
+    AFTER INSERT OR DELETE OR UPDATE OF queue, quota_key
+    ON gue_jobs
+    FOR EACH ROW
+EXECUTE PROCEDURE gue_quota_count();
@@ -0,0 +1,163 @@
+package gue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SecretRefKey is the key of JSON object referencing a secret in job args,
+// e.g. {"token": {"$secret": "payments/api-token"}}.
+const SecretRefKey = "$secret"
+
+const redactedSecret = "[REDACTED]"
+
+// SecretRef returns the reference to the secret to be used as a value in job args,
+// so that only the reference is stored in the DB and the secret value is resolved
+// with the client SecretProvider right before the job is worked.
+func SecretRef(ref string) map[string]string {
+	return map[string]string{SecretRefKey: ref}
+}
+
+// SecretProvider resolves secret references in job args to secret values.
+// Returned errors must not contain secret values.
+type SecretProvider interface {
+	Secret(ctx context.Context, ref string) (string, error)
+}
+
+// EnvSecretProvider resolves secret references to the values of the environment
+// variables named by the references with the optional prefix.
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+// Secret implements SecretProvider.Secret()
+func (p EnvSecretProvider) Secret(ctx context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(p.Prefix + ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", p.Prefix+ref)
+	}
+	return value, nil
+}
+
+// FileSecretProvider resolves secret references to the contents of the files with
+// the reference paths relative to the directory, e.g. mounted Kubernetes or Vault secrets.
+// Trailing newline is trimmed from the file contents.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret implements SecretProvider.Secret()
+func (p FileSecretProvider) Secret(ctx context.Context, ref string) (string, error) {
+	path := filepath.Join(p.Dir, filepath.FromSlash(ref))
+	if rel, err := filepath.Rel(p.Dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("secret reference %q is outside of the secrets directory", ref)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret file for reference %q: %w", ref, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecrets replaces secret references in job args with the secret values and
+// returns the function restoring the stored args. Resolved values are remembered by
+// the job to be redacted from the job errors.
+func (c *Client) resolveSecrets(ctx context.Context, j *Job) (func(), error) {
+	noop := func() {}
+	if !bytes.Contains(j.Args, []byte(SecretRefKey)) {
+		return noop, nil
+	}
+
+	var args interface{}
+	dec := json.NewDecoder(bytes.NewReader(j.Args))
+	dec.UseNumber()
+	if err := dec.Decode(&args); err != nil {
+		return noop, fmt.Errorf("could not unmarshal job args: %w", err)
+	}
+
+	var secrets []string
+	resolved, err := resolveSecretRefs(args, func(ref string) (string, error) {
+		if c.secrets == nil {
+			return "", errors.New("secret provider is not configured")
+		}
+
+		value, err := c.secrets.Secret(ctx, ref)
+		if err != nil {
+			return "", err
+		}
+
+		secrets = append(secrets, value)
+		return value, nil
+	})
+	if err != nil {
+		return noop, fmt.Errorf("could not resolve job secrets: %w", err)
+	}
+	if len(secrets) == 0 {
+		return noop, nil
+	}
+
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return noop, fmt.Errorf("could not marshal job args: %w", err)
+	}
+
+	stored := j.Args
+	j.Args = data
+	j.secrets = secrets
+
+	return func() {
+		j.Args = stored
+	}, nil
+}
+
+// resolveSecretRefs walks decoded JSON value replacing objects with the single
+// SecretRefKey string field with the resolved values.
+func resolveSecretRefs(v interface{}, resolve func(ref string) (string, error)) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := v[SecretRefKey].(string); ok && len(v) == 1 {
+			value, err := resolve(ref)
+			if err != nil {
+				return nil, fmt.Errorf("secret %q: %w", ref, err)
+			}
+			return value, nil
+		}
+
+		for k, item := range v {
+			resolved, err := resolveSecretRefs(item, resolve)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = resolved
+		}
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := resolveSecretRefs(item, resolve)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	}
+
+	return v, nil
+}
+
+// redact replaces resolved secret values in the message.
+func (j *Job) redact(msg string) string {
+	for _, secret := range j.secrets {
+		if secret != "" {
+			msg = strings.ReplaceAll(msg, secret, redactedSecret)
+		}
+	}
+	return msg
+}
@@ -0,0 +1,75 @@
+package gue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvSecretProvider(t *testing.T) {
+	require.NoError(t, os.Setenv("GUE_TEST_SECRET_TOKEN", "s3cr3t"))
+	defer os.Unsetenv("GUE_TEST_SECRET_TOKEN")
+
+	p := EnvSecretProvider{Prefix: "GUE_TEST_SECRET_"}
+
+	value, err := p.Secret(context.Background(), "TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	_, err = p.Secret(context.Background(), "MISSING")
+	assert.EqualError(t, err, `environment variable "GUE_TEST_SECRET_MISSING" is not set`)
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := testTempDir(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "payments"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "payments", "token"), []byte("s3cr3t\n"), 0600))
+
+	p := FileSecretProvider{Dir: dir}
+
+	value, err := p.Secret(context.Background(), "payments/token")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	_, err = p.Secret(context.Background(), "payments/missing")
+	assert.Error(t, err)
+
+	_, err = p.Secret(context.Background(), "../etc/passwd")
+	assert.EqualError(t, err, `secret reference "../etc/passwd" is outside of the secrets directory`)
+}
+
+func TestClientResolveSecrets(t *testing.T) {
+	require.NoError(t, os.Setenv("GUE_TEST_SECRET_TOKEN", "s3cr3t"))
+	defer os.Unsetenv("GUE_TEST_SECRET_TOKEN")
+
+	c := NewClient(nil, WithClientSecretProvider(EnvSecretProvider{Prefix: "GUE_TEST_SECRET_"}))
+	ctx := context.Background()
+
+	stored := []byte(`{"id":12345678901234567890,"auth":{"token":{"$secret":"TOKEN"}},"hooks":[{"$secret":"TOKEN"}]}`)
+	j := &Job{Args: stored}
+
+	restore, err := c.resolveSecrets(ctx, j)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":12345678901234567890,"auth":{"token":"s3cr3t"},"hooks":["s3cr3t"]}`, string(j.Args))
+	assert.Equal(t, "request failed: token [REDACTED] is invalid", j.redact("request failed: token s3cr3t is invalid"))
+
+	restore()
+	assert.Equal(t, stored, j.Args)
+
+	// objects with other fields are not references
+	notRef := &Job{Args: []byte(`{"$secret":"TOKEN","other":1}`)}
+	_, err = c.resolveSecrets(ctx, notRef)
+	require.NoError(t, err)
+	assert.Equal(t, `{"$secret":"TOKEN","other":1}`, string(notRef.Args))
+
+	_, err = c.resolveSecrets(ctx, &Job{Args: []byte(`{"token":{"$secret":"MISSING"}}`)})
+	assert.EqualError(t, err, `could not resolve job secrets: secret "MISSING": environment variable "GUE_TEST_SECRET_MISSING" is not set`)
+
+	_, err = NewClient(nil).resolveSecrets(ctx, &Job{Args: []byte(`[{"$secret":"TOKEN"}]`)})
+	assert.EqualError(t, err, `could not resolve job secrets: secret "TOKEN": secret provider is not configured`)
+}
@@ -0,0 +1,203 @@
+package gue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultShedCheckInterval = 5 * time.Second
+
+// ShedAction defines what happens to the job shed from the queue that falls behind.
+type ShedAction int
+
+const (
+	// ShedDiscard deletes shed job.
+	ShedDiscard ShedAction = iota + 1
+	// ShedDefer reschedules shed job to be worked later.
+	ShedDefer
+	// ShedMove moves shed job to the overflow queue.
+	ShedMove
+)
+
+// String returns human-readable shed action name
+func (a ShedAction) String() string {
+	switch a {
+	case ShedDiscard:
+		return "discard"
+	case ShedDefer:
+		return "defer"
+	case ShedMove:
+		return "move"
+	default:
+		return "none"
+	}
+}
+
+// ShedPolicy defines when and how low priority jobs are shed from the queue
+// instead of being worked, so that urgent jobs get more worker time when the queue falls behind.
+type ShedPolicy struct {
+	// MaxReadyAge is the threshold for the age of the oldest job ready to be worked,
+	// zero disables the check.
+	MaxReadyAge time.Duration
+	// MaxBacklog is the threshold for the number of jobs ready to be worked,
+	// zero disables the check.
+	MaxBacklog int64
+	// PriorityThreshold defines jobs to be shed - jobs with Priority greater than the
+	// threshold (that is lower priority) are shed when the queue falls behind.
+	PriorityThreshold int16
+	// Action is the action applied to shed jobs.
+	Action ShedAction
+	// DeferBy is the delay shed jobs are rescheduled with for ShedDefer action.
+	DeferBy time.Duration
+	// OverflowQueue is the queue shed jobs are moved to for ShedMove action.
+	OverflowQueue string
+	// CheckInterval is the interval queue state is checked with, defaults to 5 seconds.
+	CheckInterval time.Duration
+}
+
+// ShedStats is the number of jobs shed from the queue by action.
+type ShedStats struct {
+	Discarded int64
+	Deferred  int64
+	Moved     int64
+}
+
+type shedQueue struct {
+	policy    ShedPolicy
+	checkedAt time.Time
+	behind    bool
+}
+
+// shedder applies shed policies to locked jobs. Queue state is checked not more often
+// than at the policy check interval and is shared by all the workers of the client.
+type shedder struct {
+	mu     sync.Mutex
+	queues map[string]*shedQueue
+}
+
+func (s *shedder) setPolicy(queue string, policy ShedPolicy) {
+	if policy.CheckInterval <= 0 {
+		policy.CheckInterval = defaultShedCheckInterval
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.queues == nil {
+		s.queues = make(map[string]*shedQueue)
+	}
+	s.queues[queue] = &shedQueue{policy: policy}
+}
+
+// shed checks whether the job should be shed and applies the policy action to it.
+// Shedding runs in the savepoint, so that failed check or action does not abort
+// the job transaction and the job can still be failed with an error.
+func (s *shedder) shed(ctx context.Context, j *Job) (ShedAction, error) {
+	s.mu.Lock()
+	q, ok := s.queues[j.Queue]
+	if !ok || j.Priority <= q.policy.PriorityThreshold {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	s.mu.Unlock()
+
+	var action ShedAction
+	err := j.inSavepoint(ctx, "gue_shed", func() error {
+		var err error
+		action, err = s.shedQueued(ctx, j, q)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return action, nil
+}
+
+// shedQueued checks the job queue state and applies the policy action to the job
+// if the queue falls behind.
+func (s *shedder) shedQueued(ctx context.Context, j *Job, q *shedQueue) (ShedAction, error) {
+	s.mu.Lock()
+	now := time.Now()
+	policy := q.policy
+	behind := q.behind
+	check := now.Sub(q.checkedAt) >= policy.CheckInterval
+	if check {
+		// other workers keep using previous state while the check is in progress
+		q.checkedAt = now
+	}
+	s.mu.Unlock()
+
+	if check {
+		var (
+			backlog     int64
+			oldestReady time.Time
+		)
+		err := j.tx.QueryRow(ctx, `SELECT count(*), coalesce(min(run_at), $2)
+FROM gue_jobs
+WHERE queue = $1 AND run_at <= $2`, j.Queue, now).Scan(&backlog, &oldestReady)
+		if err != nil {
+			return 0, err
+		}
+
+		behind = (policy.MaxBacklog > 0 && backlog > policy.MaxBacklog) ||
+			(policy.MaxReadyAge > 0 && now.Sub(oldestReady) > policy.MaxReadyAge)
+
+		s.mu.Lock()
+		q.behind = behind
+		s.mu.Unlock()
+	}
+
+	if !behind {
+		return 0, nil
+	}
+
+	var err error
+	switch policy.Action {
+	case ShedDiscard:
+		err = j.giveUp(ctx, "job was shed")
+	case ShedDefer:
+		_, err = j.tx.Exec(ctx, `UPDATE gue_jobs SET run_at = $1, updated_at = $2 WHERE job_id = $3`, now.Add(policy.DeferBy), now, j.ID)
+	case ShedMove:
+		_, err = j.tx.Exec(ctx, `UPDATE gue_jobs SET queue = $1, updated_at = $2 WHERE job_id = $3`, policy.OverflowQueue, now, j.ID)
+	default:
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// stats are updated within the job transaction, so that they are shared by all
+	// the clients and survive restarts
+	_, err = j.tx.Exec(ctx, `INSERT INTO gue_shed_stats (queue, action, shed, updated_at)
+VALUES ($1, $2, 1, $3)
+ON CONFLICT (queue, action) DO UPDATE SET shed = gue_shed_stats.shed + 1, updated_at = $3`, j.Queue, policy.Action.String(), now)
+	if err != nil {
+		return 0, err
+	}
+
+	return policy.Action, nil
+}
+
+// ShedStats returns the number of jobs shed from the queue by workers of all the clients.
+func (c *Client) ShedStats(ctx context.Context, queue string) (ShedStats, error) {
+	release, err := c.budget.acquire(ctx, ConnClassProducer)
+	if err != nil {
+		return ShedStats{}, err
+	}
+	defer release()
+
+	var stats ShedStats
+	err = c.pool.QueryRow(ctx, `SELECT coalesce(sum(shed) FILTER (WHERE action = $2), 0)::bigint,
+       coalesce(sum(shed) FILTER (WHERE action = $3), 0)::bigint,
+       coalesce(sum(shed) FILTER (WHERE action = $4), 0)::bigint
+FROM gue_shed_stats
+WHERE queue = $1`, queue, ShedDiscard.String(), ShedDefer.String(), ShedMove.String()).Scan(
+		&stats.Discarded,
+		&stats.Deferred,
+		&stats.Moved,
+	)
+
+	return stats, err
+}
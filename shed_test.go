@@ -0,0 +1,39 @@
+package gue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter/fake"
+)
+
+func TestShedderShedError(t *testing.T) {
+	ctx := context.Background()
+
+	var s shedder
+	s.setPolicy("emails", ShedPolicy{MaxBacklog: 1, Action: ShedDiscard})
+
+	tx := fake.NewTx().
+		OnQueryRow("FROM gue_jobs", nil, errors.New("canceling statement due to statement timeout"))
+
+	action, err := s.shed(ctx, NewTestJob(&Job{ID: 123, Queue: "emails", Priority: 10}, tx))
+	assert.EqualError(t, err, "canceling statement due to statement timeout")
+	assert.Equal(t, ShedAction(0), action)
+
+	// failed check is rolled back to the savepoint, so the job transaction is usable
+	calls := tx.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, "SAVEPOINT gue_shed", calls[0].SQL)
+	assert.Equal(t, "ROLLBACK TO SAVEPOINT gue_shed", calls[2].SQL)
+
+	// jobs that are not subject to the policy are not checked
+	tx = fake.NewTx()
+	action, err = s.shed(ctx, NewTestJob(&Job{ID: 124, Queue: "emails", Priority: 0}, tx))
+	require.NoError(t, err)
+	assert.Equal(t, ShedAction(0), action)
+	assert.Empty(t, tx.Calls())
+}
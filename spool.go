@@ -0,0 +1,555 @@
+package gue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx"
+	"github.com/lib/pq"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+)
+
+const (
+	defaultSpoolReplayInterval = 10 * time.Second
+	defaultSpoolKeyTTL         = 24 * time.Hour
+)
+
+// SpoolStats is the snapshot of the local enqueue spool state.
+type SpoolStats struct {
+	// Jobs is the number of jobs waiting in the spool to be replayed.
+	Jobs int
+	// Bytes is the spool file size.
+	Bytes int64
+	// OldestAge is the age of the oldest spooled job, zero if the spool is empty.
+	OldestAge time.Duration
+	// Replayed is the total number of jobs replayed from the spool.
+	Replayed int64
+	// DeadLettered is the total number of spooled jobs that failed to be replayed because
+	// of the job error, e.g. constraint violation, and were moved to the dead-letter file.
+	DeadLettered int64
+}
+
+// spoolRecord is a single job stored in the spool file.
+type spoolRecord struct {
+	Key           string         `json:"key"`
+	Queue         string         `json:"queue"`
+	Priority      int16          `json:"priority"`
+	RunAt         time.Time      `json:"run_at"`
+	Type          string         `json:"type"`
+	Args          []byte         `json:"args"`
+	RetrySchedule *RetrySchedule `json:"retry_schedule,omitempty"`
+	QuotaKey      string         `json:"quota_key,omitempty"`
+	Guard         *Guard         `json:"guard,omitempty"`
+	SpooledAt     time.Time      `json:"spooled_at"`
+	// Error is set for the records moved to the dead-letter file.
+	Error string `json:"error,omitempty"`
+}
+
+func (r spoolRecord) job() *Job {
+	return &Job{
+		Queue:         r.Queue,
+		Priority:      r.Priority,
+		RunAt:         r.RunAt,
+		Type:          r.Type,
+		Args:          r.Args,
+		RetrySchedule: r.RetrySchedule,
+		QuotaKey:      r.QuotaKey,
+		Guard:         r.Guard,
+		spoolKey:      r.Key,
+	}
+}
+
+// spool is the local append-only file that stores jobs failed to be enqueued
+// because of database unavailability. Every job gets unique spool key before
+// the enqueue attempt, so replaying the job that was actually enqueued does
+// not create a duplicate.
+//
+// Jobs that fail to be replayed because of the job error are moved to the
+// dead-letter file next to the spool file, so that they do not block the spool.
+type spool struct {
+	path     string
+	interval time.Duration
+
+	// replayMu serializes replays, mu guards the spool file and is not held
+	// during the database calls, so that jobs can be spooled during the replay
+	replayMu sync.Mutex
+
+	mu           sync.Mutex
+	loaded       bool
+	file         *os.File
+	jobs         int
+	oldest       time.Time
+	replayed     int64
+	deadLettered int64
+	running      bool
+}
+
+func newSpool(path string, interval time.Duration) *spool {
+	if interval <= 0 {
+		interval = defaultSpoolReplayInterval
+	}
+
+	return &spool{path: path, interval: interval}
+}
+
+func newSpoolKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+// load opens spool file and counts already spooled jobs, must be called under the lock.
+func (s *spool) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	records, size, err := s.readAll()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	// drop incomplete trailing record, otherwise the next record is appended to it
+	// and the spool file can not be read anymore
+	if fi, err := f.Stat(); err == nil && fi.Size() > size {
+		if err := f.Truncate(size); err != nil {
+			f.Close()
+			return fmt.Errorf("could not truncate incomplete spooled job: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	s.file = f
+	s.loaded = true
+	s.setRecords(records)
+
+	return nil
+}
+
+func (s *spool) setRecords(records []spoolRecord) {
+	s.jobs = len(records)
+	s.oldest = time.Time{}
+	if len(records) > 0 {
+		s.oldest = records[0].SpooledAt
+	}
+}
+
+// readAll reads all the records from the spool file and returns them with the size of
+// the complete records. Incomplete trailing record left after the crash in the middle
+// of the write is ignored.
+func (s *spool) readAll() ([]spoolRecord, int64, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var (
+		records []spoolRecord
+		size    int64
+	)
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return records, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var record spoolRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			return nil, 0, fmt.Errorf("could not unmarshal spooled job: %w", err)
+		}
+		records = append(records, record)
+		size += int64(len(line))
+	}
+}
+
+// write appends the job to the spool file and syncs it to the disk.
+func (s *spool) write(j *Job) error {
+	data, err := json.Marshal(spoolRecord{
+		Key:           j.spoolKey,
+		Queue:         j.Queue,
+		Priority:      j.Priority,
+		RunAt:         j.RunAt,
+		Type:          j.Type,
+		Args:          j.Args,
+		RetrySchedule: j.RetrySchedule,
+		QuotaKey:      j.QuotaKey,
+		Guard:         j.Guard,
+		SpooledAt:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.jobs++
+	if s.oldest.IsZero() {
+		s.oldest = time.Now()
+	}
+
+	return nil
+}
+
+// isUnavailable returns true if the error is caused by the database unavailability,
+// e.g. connection failure or server shutdown, so that the job can be enqueued later.
+// Errors not reported by the server are caused by the connection failures, as the job
+// is validated before it gets to the database.
+func isUnavailable(err error) bool {
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) || err == adapter.ErrNoRows {
+		return false
+	}
+
+	if code, ok := sqlState(err); ok {
+		// connection exception, insufficient resources, operator intervention and system error
+		for _, class := range []string{"08", "53", "57", "58"} {
+			if strings.HasPrefix(code, class) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// sqlState returns SQLSTATE code of the error reported by PostgreSQL server
+// to any of the supported drivers, false is returned for other errors.
+func sqlState(err error) (string, bool) {
+	var pgxv3Err pgx.PgError
+	if errors.As(err, &pgxv3Err) {
+		return pgxv3Err.Code, true
+	}
+
+	var pgxv4Err *pgconn.PgError
+	if errors.As(err, &pgxv4Err) {
+		return pgxv4Err.Code, true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code), true
+	}
+
+	return "", false
+}
+
+// deadLetterPath returns the path of the file spooled jobs failed to be replayed are moved to.
+func (s *spool) deadLetterPath() string {
+	return s.path + ".dead"
+}
+
+// deadLetter appends the record to the dead-letter file and syncs it to the disk.
+func (s *spool) deadLetter(r spoolRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.deadLetterPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// replay tries to enqueue all spooled jobs in the order they were spooled and stops
+// on the first database unavailability error. Jobs exceeding the quota are kept in the
+// spool to be replayed later, jobs failed because of other errors are moved to the
+// dead-letter file. Returns the number of replayed and dead-lettered jobs.
+func (s *spool) replay(ctx context.Context, enqueue func(ctx context.Context, j *Job) error) (int, int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	err := s.load()
+	var records []spoolRecord
+	if err == nil {
+		records, _, err = s.readAll()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		kept         []spoolRecord
+		replayed     int
+		deadLettered int
+		replayErr    error
+	)
+	for i, r := range records {
+		err := enqueue(ctx, r.job())
+		if err == nil {
+			replayed++
+			continue
+		}
+
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			kept = append(kept, r)
+			continue
+		}
+
+		if ctx.Err() == nil && !isUnavailable(err) {
+			r.Error = err.Error()
+			if replayErr = s.deadLetter(r); replayErr == nil {
+				deadLettered++
+				continue
+			}
+		} else {
+			replayErr = err
+		}
+
+		kept = append(kept, records[i:]...)
+		break
+	}
+
+	if len(kept) < len(records) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// jobs spooled during the replay are appended after the replayed ones
+		current, _, err := s.readAll()
+		if err != nil {
+			return replayed, deadLettered, err
+		}
+		if len(current) < len(records) {
+			return replayed, deadLettered, errors.New("spool file was truncated during the replay")
+		}
+
+		if err := s.rewrite(append(kept, current[len(records):]...)); err != nil {
+			return replayed, deadLettered, err
+		}
+		s.replayed += int64(replayed)
+		s.deadLettered += int64(deadLettered)
+	}
+
+	return replayed, deadLettered, replayErr
+}
+
+// rewrite atomically replaces spool file with the given records, must be called under the lock.
+func (s *spool) rewrite(records []spoolRecord) error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		// nolint:errcheck
+		dir.Sync()
+		dir.Close()
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		s.loaded = false
+		return err
+	}
+
+	s.setRecords(records)
+	return nil
+}
+
+func (s *spool) stats() SpoolStats {
+	if s == nil {
+		return SpoolStats{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// nolint:errcheck
+	s.load()
+
+	stats := SpoolStats{Jobs: s.jobs, Replayed: s.replayed, DeadLettered: s.deadLettered}
+	if fi, err := os.Stat(s.path); err == nil {
+		stats.Bytes = fi.Size()
+	}
+	if !s.oldest.IsZero() {
+		stats.OldestAge = time.Since(s.oldest)
+	}
+
+	return stats
+}
+
+// StartSpoolReplayer starts replaying spooled jobs at the spool replay interval. This function
+// runs in its own goroutine, use cancel context to shut it down.
+func (c *Client) StartSpoolReplayer(ctx context.Context) error {
+	if c.spool == nil {
+		return errors.New("spool is not configured for the client")
+	}
+
+	c.spool.mu.Lock()
+	defer c.spool.mu.Unlock()
+
+	if c.spool.running {
+		return fmt.Errorf("client[id=%s] spool replayer is already running", c.id)
+	}
+
+	c.spool.running = true
+	go func() {
+		defer func() {
+			c.spool.mu.Lock()
+			c.spool.running = false
+			c.spool.mu.Unlock()
+			c.logger.Info("Spool replayer finished")
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.spool.interval):
+			}
+
+			if _, err := c.ReplaySpool(ctx); err != nil {
+				c.logger.Debug("Failed to replay spooled jobs", adapter.Err(err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+// ReplaySpool tries to enqueue all spooled jobs and returns the number of replayed jobs.
+// Replaying stops on the first database unavailability error, not replayed jobs are kept
+// in the spool. Jobs that can not be enqueued because of the job error, e.g. constraint
+// violation, are moved to the dead-letter file with the spool file path and ".dead" suffix.
+// Expired spool keys are purged after the replay, see PurgeSpoolKeys.
+func (c *Client) ReplaySpool(ctx context.Context) (int, error) {
+	if c.spool == nil {
+		return 0, errors.New("spool is not configured for the client")
+	}
+
+	replayed, deadLettered, err := c.spool.replay(ctx, func(ctx context.Context, j *Job) error {
+		release, err := c.budget.acquire(ctx, ConnClassProducer)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		err = c.enqueue(ctx, j)
+		if err == adapter.ErrNoRows {
+			// job with the same spool key is already enqueued
+			return nil
+		}
+		return err
+	})
+
+	if replayed > 0 {
+		c.logger.Info("Replayed spooled jobs", adapter.F("count", replayed), adapter.Err(err))
+	}
+	if deadLettered > 0 {
+		c.logger.Error("Failed to replay spooled jobs, jobs are moved to the dead-letter file",
+			adapter.F("count", deadLettered), adapter.F("path", c.spool.deadLetterPath()))
+	}
+	if err != nil {
+		return replayed, err
+	}
+
+	if _, err := c.PurgeSpoolKeys(ctx); err != nil {
+		return replayed, fmt.Errorf("could not purge expired spool keys: %w", err)
+	}
+
+	return replayed, nil
+}
+
+// PurgeSpoolKeys deletes expired spool keys and returns the number of deleted keys.
+// ReplaySpool purges expired keys after every replay.
+func (c *Client) PurgeSpoolKeys(ctx context.Context) (int64, error) {
+	return c.execAdmin(ctx, `DELETE FROM gue_spool_keys WHERE expires_at <= $1`, time.Now())
+}
+
+// SpoolStats returns local enqueue spool statistics.
+// Zero value is returned if spool is not configured for the client.
+func (c *Client) SpoolStats() SpoolStats {
+	return c.spool.stats()
+}
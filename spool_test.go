@@ -0,0 +1,286 @@
+package gue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vgarvardt/gue/v2/adapter"
+	adapterTesting "github.com/vgarvardt/gue/v2/adapter/testing"
+)
+
+func TestSpoolWriteReplay(t *testing.T) {
+	path := filepath.Join(testTempDir(t), "gue.spool")
+	s := newSpool(path, 0)
+	ctx := context.Background()
+
+	assert.Equal(t, SpoolStats{}, s.stats())
+
+	for _, jobType := range []string{"first", "second", "third"} {
+		key, err := newSpoolKey()
+		require.NoError(t, err)
+
+		err = s.write(&Job{Type: jobType, Args: []byte(`{"foo":"bar"}`), spoolKey: key})
+		require.NoError(t, err)
+	}
+
+	stats := s.stats()
+	assert.Equal(t, 3, stats.Jobs)
+	assert.Greater(t, stats.Bytes, int64(0))
+	assert.Greater(t, int64(stats.OldestAge), int64(0))
+
+	// spool state survives restart
+	s = newSpool(path, 0)
+	assert.Equal(t, 3, s.stats().Jobs)
+
+	var replayedTypes []string
+	errReplay := errors.New("db is down")
+	replayed, _, err := s.replay(ctx, func(ctx context.Context, j *Job) error {
+		if j.Type == "third" {
+			return errReplay
+		}
+		assert.NotEmpty(t, j.spoolKey)
+		assert.Equal(t, []byte(`{"foo":"bar"}`), j.Args)
+		replayedTypes = append(replayedTypes, j.Type)
+		return nil
+	})
+	assert.Equal(t, errReplay, err)
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, []string{"first", "second"}, replayedTypes)
+
+	stats = s.stats()
+	assert.Equal(t, 1, stats.Jobs)
+	assert.Equal(t, int64(2), stats.Replayed)
+
+	replayed, _, err = s.replay(ctx, func(ctx context.Context, j *Job) error {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+
+	stats = s.stats()
+	assert.Equal(t, 0, stats.Jobs)
+	assert.Equal(t, time.Duration(0), stats.OldestAge)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestSpoolIncompleteRecord(t *testing.T) {
+	path := filepath.Join(testTempDir(t), "gue.spool")
+	ctx := context.Background()
+
+	s := newSpool(path, 0)
+	require.NoError(t, s.write(&Job{Type: "first", Args: []byte(`[]`), spoolKey: "first"}))
+
+	// crash in the middle of the write leaves incomplete record without trailing newline
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(`{"key":"second","queue":"","prio`))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s = newSpool(path, 0)
+	require.NoError(t, s.write(&Job{Type: "third", Args: []byte(`[]`), spoolKey: "third"}))
+	assert.Equal(t, 2, s.stats().Jobs)
+
+	// spool is still readable after restart
+	s = newSpool(path, 0)
+	var replayedTypes []string
+	replayed, _, err := s.replay(ctx, func(ctx context.Context, j *Job) error {
+		replayedTypes = append(replayedTypes, j.Type)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, []string{"first", "third"}, replayedTypes)
+}
+
+func TestSpoolWriteDuringReplay(t *testing.T) {
+	path := filepath.Join(testTempDir(t), "gue.spool")
+	s := newSpool(path, 0)
+	ctx := context.Background()
+
+	require.NoError(t, s.write(&Job{Type: "first", Args: []byte(`[]`), spoolKey: "first"}))
+
+	replayed, _, err := s.replay(ctx, func(ctx context.Context, j *Job) error {
+		// spooling is not blocked by the replay in progress
+		return s.write(&Job{Type: "second", Args: []byte(`[]`), spoolKey: "second"})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+
+	records, _, err := s.readAll()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "second", records[0].Type)
+	assert.Equal(t, 1, s.stats().Jobs)
+}
+
+func TestSpoolReplayDeadLetter(t *testing.T) {
+	path := filepath.Join(testTempDir(t), "gue.spool")
+	s := newSpool(path, 0)
+	ctx := context.Background()
+
+	for _, jobType := range []string{"invalid", "quota", "valid", "unavailable", "last"} {
+		require.NoError(t, s.write(&Job{Type: jobType, Args: []byte(`[]`), spoolKey: jobType}))
+	}
+
+	var replayedTypes []string
+	errUnavailable := &pgconn.PgError{Code: "57P03", Message: "the database system is starting up"}
+	replayed, deadLettered, err := s.replay(ctx, func(ctx context.Context, j *Job) error {
+		switch j.Type {
+		case "invalid":
+			return &pgconn.PgError{Severity: "ERROR", Code: "22P02", Message: "invalid input syntax for type json"}
+		case "quota":
+			return &QuotaExceededError{Queue: j.Queue, QuotaKey: "tenant-1", MaxPending: 1}
+		case "unavailable":
+			return errUnavailable
+		}
+		replayedTypes = append(replayedTypes, j.Type)
+		return nil
+	})
+	assert.Equal(t, errUnavailable, err)
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, 1, deadLettered)
+	assert.Equal(t, []string{"valid"}, replayedTypes)
+
+	stats := s.stats()
+	assert.Equal(t, 3, stats.Jobs)
+	assert.Equal(t, int64(1), stats.DeadLettered)
+
+	records, _, err := s.readAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "quota", records[0].Type)
+	assert.Equal(t, "unavailable", records[1].Type)
+	assert.Equal(t, "last", records[2].Type)
+
+	data, err := ioutil.ReadFile(s.deadLetterPath())
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"type":"invalid"`)
+	assert.Contains(t, string(data), `"error":"ERROR: invalid input syntax for type json (SQLSTATE 22P02)"`)
+}
+
+func TestIsUnavailable(t *testing.T) {
+	assert.True(t, isUnavailable(errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")))
+	assert.True(t, isUnavailable(pgx.PgError{Code: "08006", Message: "connection failure"}))
+	assert.True(t, isUnavailable(&pgconn.PgError{Code: "57P01", Message: "admin shutdown"}))
+	assert.True(t, isUnavailable(fmt.Errorf("could not enqueue: %w", &pq.Error{Code: "53300", Message: "too many connections"})))
+	assert.False(t, isUnavailable(pgx.PgError{Code: "23502", Message: "not null violation"}))
+	assert.False(t, isUnavailable(&pgconn.PgError{Code: "23502", Message: "not null violation"}))
+	assert.False(t, isUnavailable(&pq.Error{Code: "23502", Message: "not null violation"}))
+	assert.False(t, isUnavailable(&QuotaExceededError{}))
+	assert.False(t, isUnavailable(adapter.ErrNoRows))
+}
+
+func TestClientEnqueueSpoolInvalidJob(t *testing.T) {
+	c := NewClient(nil, WithClientSpool(filepath.Join(testTempDir(t), "gue.spool"), time.Second))
+
+	err := c.Enqueue(context.Background(), &Job{Type: "MyJob", Guard: &Guard{}})
+	assert.Equal(t, ErrInvalidGuard, err)
+	assert.Equal(t, 0, c.SpoolStats().Jobs)
+}
+
+func TestClientReplaySpool(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testClientReplaySpool(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testClientReplaySpool(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testClientReplaySpool(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testClientReplaySpool(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool, WithClientSpool(filepath.Join(testTempDir(t), "gue.spool"), time.Second))
+	ctx := context.Background()
+
+	// job was actually enqueued, but the client did not get the response
+	j := &Job{Type: "MyJob"}
+	err := c.Enqueue(ctx, j)
+	require.NoError(t, err)
+	require.NotEmpty(t, j.spoolKey)
+
+	err = c.spool.write(j)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.SpoolStats().Jobs)
+
+	replayed, err := c.ReplaySpool(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, 0, c.SpoolStats().Jobs)
+
+	var count int
+	err = connPool.QueryRow(ctx, `SELECT count(*) FROM gue_jobs`).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// job was worked and deleted before the replay
+	locked, err := c.LockJob(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, locked)
+	require.NoError(t, locked.Delete(ctx))
+	require.NoError(t, locked.Done(ctx))
+
+	err = c.spool.write(j)
+	require.NoError(t, err)
+
+	replayed, err = c.ReplaySpool(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+
+	err = connPool.QueryRow(ctx, `SELECT count(*) FROM gue_jobs`).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// expired spool keys are purged
+	purged, err := NewClient(connPool, WithClientSpoolKeyTTL(time.Nanosecond)).PurgeSpoolKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	c = NewClient(connPool, WithClientSpoolKeyTTL(time.Nanosecond), WithClientSpool(filepath.Join(testTempDir(t), "gue.spool"), time.Second))
+	require.NoError(t, c.Enqueue(ctx, &Job{Type: "MyJob"}))
+	time.Sleep(time.Millisecond)
+
+	purged, err = c.PurgeSpoolKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	// replay purges expired spool keys as well
+	require.NoError(t, c.Enqueue(ctx, &Job{Type: "MyJob"}))
+	time.Sleep(time.Millisecond)
+
+	_, err = c.ReplaySpool(ctx)
+	require.NoError(t, err)
+
+	err = connPool.QueryRow(ctx, `SELECT count(*) FROM gue_spool_keys`).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func testTempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "gue")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, os.RemoveAll(dir))
+	})
+
+	return dir
+}
@@ -3,6 +3,7 @@ package gue
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
 	"sync"
@@ -17,7 +18,8 @@ const (
 )
 
 // WorkFunc is a function that performs a Job. If an error is returned, the job
-// is re-enqueued with exponential backoff.
+// is re-enqueued with exponential backoff. If ErrAwaitChildren is returned, the job
+// is parked until all the children it spawned are finished.
 type WorkFunc func(j *Job) error
 
 // WorkMap is a map of Job names to WorkFuncs that are used to perform Jobs of a
@@ -38,8 +40,9 @@ type Worker struct {
 }
 
 // NewWorker returns a Worker that fetches Jobs from the Client and executes
-// them using WorkMap. If the type of Job is not registered in the WorkMap, it's
-// considered an error and the job is re-enqueued with a backoff.
+// them using WorkMap. Jobs of types aliased with client type aliases are worked
+// by the handlers of the new types. If the type of Job is not registered in the WorkMap,
+// it's considered an error and the job is re-enqueued with a backoff.
 //
 // Worker defaults to a poll interval of 5 seconds, which can be overridden by
 // WithWorkerPollInterval option.
@@ -120,7 +123,14 @@ func (w *Worker) WorkOne(ctx context.Context) (didWork bool) {
 		return // no job was available
 	}
 
+	w.workJob(ctx, j)
+	return true
+}
+
+// workJob works already locked job and marks it as done.
+func (w *Worker) workJob(ctx context.Context, j *Job) {
 	ll := w.logger.With(adapter.F("job-id", j.ID), adapter.F("job-type", j.Type))
+	j.workerID = w.id
 
 	defer func() {
 		if err := j.Done(ctx); err != nil {
@@ -129,29 +139,122 @@ func (w *Worker) WorkOne(ctx context.Context) (didWork bool) {
 	}()
 	defer recoverPanic(ctx, ll, j)
 
-	didWork = true
+	shed, err := w.c.shedder.shed(ctx, j)
+	if err != nil {
+		ll.Error("Got an error on checking job for shedding", adapter.Err(err))
+		if jErr := j.Error(ctx, err.Error()); jErr != nil {
+			ll.Error("Got an error on setting an error to a job with failed shed check", adapter.Err(jErr))
+		}
+		return
+	}
+	if shed != 0 {
+		ll.Info("Job was shed", adapter.F("shed-action", shed))
+		return
+	}
+
+	pass, err := w.c.checkGuard(ctx, j)
+	if err != nil {
+		ll.Error("Got an error on checking job guard", adapter.Err(err))
+		if jErr := j.Error(ctx, err.Error()); jErr != nil {
+			ll.Error("Got an error on setting an error to a job with failed guard check", adapter.Err(jErr))
+		}
+		return
+	}
+	if !pass {
+		reason := j.Guard.skipReason()
+		if err := j.skip(ctx, reason); err != nil {
+			ll.Error("Got an error on skipping a job", adapter.Err(err))
+		}
+		ll.Info("Job was skipped", adapter.F("reason", reason))
+		return
+	}
 
-	wf, ok := w.wm[j.Type]
+	wf, jobType, ok := w.workFunc(j.Type)
 	if !ok {
 		ll.Error("Got a job with unknown type")
-		if err = j.Error(ctx, fmt.Sprintf("worker[id=%s] unknown job type: %q", w.id, j.Type)); err != nil {
+		if err := j.Error(ctx, fmt.Sprintf("worker[id=%s] unknown job type: %q", w.id, j.Type)); err != nil {
 			ll.Error("Got an error on setting an error to unknown job", adapter.Err(err))
 		}
 		return
 	}
 
-	if err = wf(j); err != nil {
+	memoized, err := w.c.memoized(ctx, j, jobType)
+	if err != nil {
+		ll.Error("Got an error on looking up memoized job result", adapter.Err(err))
 		if jErr := j.Error(ctx, err.Error()); jErr != nil {
-			ll.Error("Got an error on setting an error to an errored job", adapter.Err(jErr), adapter.F("job-error", err))
+			ll.Error("Got an error on setting an error to a job with failed memoized result lookup", adapter.Err(jErr))
 		}
 		return
 	}
+	if memoized {
+		ll.Debug("Job result is memoized")
+	} else {
+		restoreArgs, err := w.c.resolveSecrets(ctx, j)
+		if err != nil {
+			ll.Error("Got an error on resolving job secrets", adapter.Err(err))
+			if jErr := j.Error(ctx, err.Error()); jErr != nil {
+				ll.Error("Got an error on setting an error to a job with unresolved secrets", adapter.Err(jErr))
+			}
+			return
+		}
+		// args with resolved secrets must not outlive the handler, even if it panics
+		defer restoreArgs()
+
+		err = wf(j)
+		restoreArgs()
+		if err != nil {
+			if errors.Is(err, ErrAwaitChildren) {
+				aErr := j.awaitChildren(ctx)
+				if aErr == nil {
+					ll.Debug("Job is awaiting children")
+					return
+				}
+				if aErr != errNoPendingChildren {
+					ll.Error("Got an error on parking a job awaiting children", adapter.Err(aErr))
+				}
+				// job can not be parked or would never be resumed, so it is failed instead
+				err = aErr
+			}
 
-	if err = j.Delete(ctx); err != nil {
+			if jErr := j.Error(ctx, err.Error()); jErr != nil {
+				ll.Error("Got an error on setting an error to an errored job", adapter.Err(jErr), adapter.F("job-error", j.redact(err.Error())))
+			}
+			return
+		}
+
+		if err := j.validateResult(); err != nil {
+			ll.Error("Got an invalid job result", adapter.Err(err))
+			if jErr := j.Error(ctx, err.Error()); jErr != nil {
+				ll.Error("Got an error on setting an error to a job with invalid result", adapter.Err(jErr))
+			}
+			return
+		}
+
+		if err := w.c.memoize(ctx, j, jobType); err != nil {
+			ll.Error("Got an error on memoizing job result", adapter.Err(err))
+			if jErr := j.Error(ctx, err.Error()); jErr != nil {
+				ll.Error("Got an error on setting an error to a job with failed result memoization", adapter.Err(jErr))
+			}
+			return
+		}
+	}
+
+	if err := j.Delete(ctx); err != nil {
 		ll.Error("Got an error on deleting a job", adapter.Err(err))
 	}
 	ll.Debug("Job finished")
-	return
+}
+
+// workFunc returns WorkFunc for the job type and the type it is registered for,
+// jobs of the aliased types are dispatched to the handlers of the new types.
+func (w *Worker) workFunc(jobType string) (WorkFunc, string, bool) {
+	if wf, ok := w.wm[jobType]; ok {
+		return wf, jobType, true
+	}
+
+	jobType = w.c.aliases.Resolve(jobType)
+	wf, ok := w.wm[jobType]
+	return wf, jobType, ok
 }
 
 // recoverPanic tries to handle panics in job execution.
@@ -166,7 +269,7 @@ func recoverPanic(ctx context.Context, logger adapter.Logger, j *Job) {
 		fmt.Fprintf(buf, "%v\n", r)
 		fmt.Fprintln(buf, string(stackBuf[:n]))
 		fmt.Fprintln(buf, "[...]")
-		stacktrace := buf.String()
+		stacktrace := j.redact(buf.String())
 
 		logger.Error("Job panicked", adapter.F("stacktrace", stacktrace))
 		if err := j.Error(ctx, stacktrace); err != nil {
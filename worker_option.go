@@ -21,6 +21,8 @@ func WithWorkerPollInterval(d time.Duration) WorkerOption {
 }
 
 // WithWorkerQueue overrides default worker queue name with the given value.
+// Queue can be the wildcard pattern, e.g. "emails.*", to work jobs from all
+// the queues below the hierarchy level.
 func WithWorkerQueue(queue string) WorkerOption {
 	return func(w *Worker) {
 		w.queue = queue
@@ -50,6 +52,8 @@ func WithPoolPollInterval(d time.Duration) WorkerPoolOption {
 }
 
 // WithPoolQueue overrides default worker queue name with the given value.
+// Queue can be the wildcard pattern, e.g. "emails.*", to work jobs from all
+// the queues below the hierarchy level.
 func WithPoolQueue(queue string) WorkerPoolOption {
 	return func(w *WorkerPool) {
 		w.queue = queue
@@ -2,7 +2,11 @@ package gue
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -279,3 +283,346 @@ func testWorkerWorkOneTypeNotInMap(t *testing.T, connPool adapter.ConnPool) {
 	require.NotEqual(t, pgtype.Null, j.LastError.Status)
 	assert.Contains(t, j.LastError.String, `unknown job type: "MyJob"`)
 }
+
+func TestWorkerWorkOneShed(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneShed(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneShed(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneShed(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneShed(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool, WithClientShedPolicy("", ShedPolicy{
+		MaxBacklog:        1,
+		PriorityThreshold: 0,
+		Action:            ShedMove,
+		OverflowQueue:     "overflow",
+	}))
+	ctx := context.Background()
+
+	var worked []int16
+	wm := WorkMap{
+		"MyJob": func(j *Job) error {
+			worked = append(worked, j.Priority)
+			return nil
+		},
+	}
+	w := NewWorker(c, wm)
+
+	for _, priority := range []int16{0, 10, 10} {
+		err := c.Enqueue(ctx, &Job{Type: "MyJob", Priority: priority})
+		require.NoError(t, err)
+	}
+
+	// urgent job is worked regardless of the backlog
+	assert.True(t, w.WorkOne(ctx))
+	// queue still has 2 jobs in the backlog, so low priority job is moved
+	assert.True(t, w.WorkOne(ctx))
+	stats, err := c.ShedStats(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, ShedStats{Moved: 1}, stats)
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+
+	var overflow int
+	err = connPool.QueryRow(ctx, `SELECT count(*) FROM gue_jobs WHERE queue = 'overflow'`).Scan(&overflow)
+	require.NoError(t, err)
+	assert.Equal(t, 1, overflow)
+	assert.Equal(t, []int16{0}, worked)
+}
+
+func TestWorkerWorkOneMemoize(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneMemoize(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneMemoize(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneMemoize(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneMemoize(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool, WithClientMemoize("Report", time.Hour))
+	ctx := context.Background()
+
+	var (
+		rendered int
+		results  [][]byte
+	)
+	wm := WorkMap{
+		"Report": func(j *Job) error {
+			rendered++
+			j.Result = []byte(`{"url":"https://example.com/report.pdf"}`)
+			return nil
+		},
+		"BrokenReport": func(j *Job) error {
+			j.Result = []byte("done")
+			return nil
+		},
+	}
+	w := NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+
+	// args formatting and keys order do not matter
+	for _, args := range []string{`{"a":1,"b":2}`, `{"b": 2, "a": 1}`, `{"a":1,"b":3}`} {
+		err := c.Enqueue(ctx, &Job{Type: "Report", Args: []byte(args)})
+		require.NoError(t, err)
+
+		j, err := c.LockJob(ctx, "")
+		require.NoError(t, err)
+		require.NotNil(t, j)
+
+		w.workJob(ctx, j)
+		results = append(results, j.Result)
+	}
+
+	assert.Equal(t, 2, rendered)
+	assert.JSONEq(t, `{"url":"https://example.com/report.pdf"}`, string(results[1]))
+	assert.Nil(t, findOneJob(t, connPool))
+
+	purged, err := c.PurgeMemoizedResults(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	// job with invalid result is failed instead of being worked again right away
+	c = NewClient(connPool, WithClientMemoize("BrokenReport", time.Hour))
+	w = NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+	require.NoError(t, c.Enqueue(ctx, &Job{Type: "BrokenReport"}))
+	require.True(t, w.WorkOne(ctx))
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+	assert.Equal(t, int32(1), j.ErrorCount)
+	assert.Equal(t, errInvalidResult.Error(), j.LastError.String)
+}
+
+func TestWorkerWorkOneAwaitChildren(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneAwaitChildren(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneAwaitChildren(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneAwaitChildren(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneAwaitChildren(t *testing.T, connPool adapter.ConnPool) {
+	noBackoff := func(retries int) time.Duration {
+		return 0
+	}
+
+	c := NewClient(connPool, WithClientBackoff(noBackoff), WithClientChildMaxAttempts(2))
+	ctx := context.Background()
+
+	var (
+		parentRuns int
+		outcomes   []ChildOutcome
+	)
+	wm := WorkMap{
+		"Parent": func(j *Job) error {
+			parentRuns++
+
+			var err error
+			outcomes, err = j.ChildOutcomes(ctx)
+			if err != nil {
+				return err
+			}
+			if len(outcomes) > 0 {
+				return nil
+			}
+
+			if err := j.SpawnChild(ctx, &Job{Type: "Child"}); err != nil {
+				return err
+			}
+			if err := j.SpawnChild(ctx, &Job{Type: "Fail"}); err != nil {
+				return err
+			}
+			return ErrAwaitChildren
+		},
+		"Child": func(j *Job) error {
+			j.Result = []byte(`{"ok":true}`)
+			return nil
+		},
+		"Fail": func(j *Job) error {
+			return errors.New("child failed")
+		},
+	}
+	w := NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+
+	err := c.Enqueue(ctx, &Job{Type: "Parent"})
+	require.NoError(t, err)
+
+	// parent spawns children and both children are worked while parent is waiting,
+	// failing child is given up after max attempts
+	for i := 0; i < 4; i++ {
+		require.True(t, w.WorkOne(ctx))
+	}
+	assert.Equal(t, 1, parentRuns)
+
+	// parent is resumed once all the children are finished
+	require.True(t, w.WorkOne(ctx))
+	assert.Equal(t, 2, parentRuns)
+	require.Len(t, outcomes, 2)
+
+	assert.Equal(t, "Child", outcomes[0].Type)
+	assert.True(t, outcomes[0].Succeeded)
+	assert.JSONEq(t, `{"ok":true}`, string(outcomes[0].Result))
+
+	assert.Equal(t, "Fail", outcomes[1].Type)
+	assert.False(t, outcomes[1].Succeeded)
+	assert.Equal(t, "child failed", outcomes[1].Error)
+
+	assert.False(t, w.WorkOne(ctx))
+
+	var remaining int
+	err = connPool.QueryRow(ctx, `SELECT count(*) FROM gue_child_outcomes`).Scan(&remaining)
+	require.NoError(t, err)
+	assert.Equal(t, 0, remaining)
+}
+
+func TestWorkerWorkOneChildInvalidResult(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneChildInvalidResult(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneChildInvalidResult(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneChildInvalidResult(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneChildInvalidResult(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool, WithClientChildMaxAttempts(1))
+	ctx := context.Background()
+
+	var outcomes []ChildOutcome
+	wm := WorkMap{
+		"Parent": func(j *Job) error {
+			var err error
+			if outcomes, err = j.ChildOutcomes(ctx); err != nil || len(outcomes) > 0 {
+				return err
+			}
+
+			if err := j.SpawnChild(ctx, &Job{Type: "Child"}); err != nil {
+				return err
+			}
+			return ErrAwaitChildren
+		},
+		"Child": func(j *Job) error {
+			j.Result = []byte("done")
+			return nil
+		},
+	}
+	w := NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+
+	require.NoError(t, c.Enqueue(ctx, &Job{Type: "Parent"}))
+
+	// child with invalid result is failed and given up, so the parent is resumed
+	for i := 0; i < 3; i++ {
+		require.True(t, w.WorkOne(ctx))
+	}
+	require.Len(t, outcomes, 1)
+	assert.False(t, outcomes[0].Succeeded)
+	assert.Equal(t, errInvalidResult.Error(), outcomes[0].Error)
+
+	assert.False(t, w.WorkOne(ctx))
+}
+
+func TestWorkerWorkOneAwaitNoChildren(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneAwaitNoChildren(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneAwaitNoChildren(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneAwaitNoChildren(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneAwaitNoChildren(t *testing.T, connPool adapter.ConnPool) {
+	c := NewClient(connPool)
+	ctx := context.Background()
+
+	wm := WorkMap{
+		"Parent": func(j *Job) error {
+			return ErrAwaitChildren
+		},
+	}
+	w := NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+
+	err := c.Enqueue(ctx, &Job{Type: "Parent"})
+	require.NoError(t, err)
+
+	// job without pending children is failed instead of being parked forever
+	require.True(t, w.WorkOne(ctx))
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+	assert.Equal(t, int32(1), j.ErrorCount)
+	assert.Equal(t, errNoPendingChildren.Error(), j.LastError.String)
+
+	var waiting int
+	err = connPool.QueryRow(ctx, `SELECT waiting_children FROM gue_jobs WHERE job_id = $1`, j.ID).Scan(&waiting)
+	require.NoError(t, err)
+	assert.Equal(t, 0, waiting)
+}
+
+func TestWorkerWorkOneSecrets(t *testing.T) {
+	t.Run("pgx/v3", func(t *testing.T) {
+		testWorkerWorkOneSecrets(t, adapterTesting.OpenTestPoolPGXv3(t))
+	})
+	t.Run("pgx/v4", func(t *testing.T) {
+		testWorkerWorkOneSecrets(t, adapterTesting.OpenTestPoolPGXv4(t))
+	})
+	t.Run("lib/pq", func(t *testing.T) {
+		testWorkerWorkOneSecrets(t, adapterTesting.OpenTestPoolLibPQ(t))
+	})
+}
+
+func testWorkerWorkOneSecrets(t *testing.T, connPool adapter.ConnPool) {
+	dir := testTempDir(t)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "api-token"), []byte("s3cr3t"), 0600))
+
+	c := NewClient(connPool, WithClientSecretProvider(FileSecretProvider{Dir: dir}))
+	ctx := context.Background()
+
+	var token string
+	wm := WorkMap{
+		"CallAPI": func(j *Job) error {
+			var args struct {
+				Token string `json:"token"`
+			}
+			if err := json.Unmarshal(j.Args, &args); err != nil {
+				return err
+			}
+			token = args.Token
+			return fmt.Errorf("token %s is invalid", args.Token)
+		},
+	}
+	w := NewWorker(c, wm, WithWorkerLogger(adapter.NoOpLogger{}))
+
+	args, err := json.Marshal(map[string]interface{}{"token": SecretRef("api-token")})
+	require.NoError(t, err)
+
+	err = c.Enqueue(ctx, &Job{Type: "CallAPI", Args: args})
+	require.NoError(t, err)
+
+	require.True(t, w.WorkOne(ctx))
+	assert.Equal(t, "s3cr3t", token)
+
+	j := findOneJob(t, connPool)
+	require.NotNil(t, j)
+	assert.JSONEq(t, `{"token":{"$secret":"api-token"}}`, string(j.Args))
+	assert.Equal(t, "token [REDACTED] is invalid", j.LastError.String)
+}